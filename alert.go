@@ -0,0 +1,451 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AlertRule fires alert when condition holds for ForSeconds, e.g.
+// service is inactive on at least 2 nodes for 2 minutes -- critical
+type AlertRule struct {
+	Name       string
+	Service    string         // all services if empty
+	States     []ServiceState // matched states, all states except active if empty
+	MinNodes   int            // number of nodes in matched states, 0 -- total service status is matched
+	ForSeconds int
+	Severity   string // info / warning / critical
+}
+
+// Silence suppresses alerts matched by service, node and rule until EndsAt
+type Silence struct {
+	ID       string
+	Service  string // all services if empty
+	Node     string // all nodes if empty
+	Rule     string // all rules if empty
+	StartsAt time.Time
+	EndsAt   time.Time
+	Comment  string
+}
+
+// MaintenanceWindow suppresses alerts and auto-remediation of services and nodes
+type MaintenanceWindow struct {
+	Name       string
+	Services   []string // all services if empty
+	Nodes      []string // all nodes if empty, window with nodes doesn't cover service as a whole
+	StartsAt   time.Time
+	EndsAt     time.Time
+	RepeatDays int // window is repeated every RepeatDays, 0 -- once
+	Comment    string
+}
+
+type ruleState struct {
+	since    time.Time // condition holds since
+	firing   bool
+	notified bool
+	alert    *Alert
+}
+
+func (r *AlertRule) copy() *AlertRule {
+	cp := *r
+	if r.States != nil {
+		cp.States = append([]ServiceState{}, r.States...)
+	}
+	return &cp
+}
+
+func (w *MaintenanceWindow) copy() *MaintenanceWindow {
+	cp := *w
+	if w.Services != nil {
+		cp.Services = append([]string{}, w.Services...)
+	}
+	if w.Nodes != nil {
+		cp.Nodes = append([]string{}, w.Nodes...)
+	}
+	return &cp
+}
+
+func (r *AlertRule) Valid() error {
+	if r.Name == "" {
+		return errors.New("Alert rule validation: undefined name")
+	}
+	if strings.Contains(r.Name, "/") { // name is a prefix of state keys
+		return errors.New("Alert rule validation: name must not contain '/'")
+	}
+	if r.MinNodes < 0 || r.ForSeconds < 0 {
+		return errors.New("Alert rule validation: nodes and duration must not be negative")
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = SeverityWarning
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("Alert rule validation: unknown '%s' severity", r.Severity)
+	}
+	return nil
+}
+
+// match returns true and nodes in matched states if condition is true for status
+func (r *AlertRule) match(status *ServiceStatusInfo) (bool, []string) {
+	matched := func(s ServiceState) bool {
+		if len(r.States) < 1 {
+			return isKnown(s) && s != ServiceStateActive
+		}
+		return containsState(r.States, s)
+	}
+	nodes := []string{}
+	for _, n := range status.NodeStatus {
+		if matched(n.ServiceStatus) {
+			nodes = append(nodes, n.NodeName)
+		}
+	}
+	if r.MinNodes < 1 {
+		return matched(status.ServiceStatus), nodes
+	}
+	return len(nodes) >= r.MinNodes, nodes
+}
+
+func (s *Silence) Valid() error {
+	if s.EndsAt.IsZero() {
+		return errors.New("Silence validation: undefined end")
+	}
+	if s.StartsAt.IsZero() {
+		s.StartsAt = time.Now()
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return errors.New("Silence validation: end must be after start")
+	}
+	return nil
+}
+
+func (s *Silence) Active(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+func (s *Silence) Match(alert *Alert) bool {
+	return (s.Service == "" || s.Service == alert.Service) &&
+		(s.Node == "" || s.Node == alert.Node) &&
+		(s.Rule == "" || s.Rule == alert.Rule)
+}
+
+func (m *MaintenanceWindow) Valid() error {
+	if m.Name == "" {
+		return errors.New("Maintenance window validation: undefined name")
+	}
+	if m.StartsAt.IsZero() || !m.EndsAt.After(m.StartsAt) {
+		return errors.New("Maintenance window validation: end must be after start")
+	}
+	if m.RepeatDays < 0 {
+		return errors.New("Maintenance window validation: repeat must not be negative")
+	}
+	if m.RepeatDays > 0 && m.EndsAt.Sub(m.StartsAt) >= time.Duration(m.RepeatDays)*24*time.Hour {
+		return errors.New("Maintenance window validation: window is longer than repeat period")
+	}
+	return nil
+}
+
+func (m *MaintenanceWindow) Active(now time.Time) bool {
+	if now.Before(m.StartsAt) {
+		return false
+	}
+	offset := now.Sub(m.StartsAt)
+	if m.RepeatDays > 0 {
+		offset = offset % (time.Duration(m.RepeatDays) * 24 * time.Hour)
+	}
+	return offset < m.EndsAt.Sub(m.StartsAt)
+}
+
+// Match returns true if window covers service on node, empty node matches service as a whole
+func (m *MaintenanceWindow) Match(serviceName, nodeName string) bool {
+	if len(m.Services) > 0 && !containsString(m.Services, serviceName) {
+		return false
+	}
+	if len(m.Nodes) > 0 {
+		return nodeName != "" && containsString(m.Nodes, nodeName)
+	}
+	return true
+}
+
+func (o *Orchestrator) AddAlertRules(rules ...*AlertRule) error {
+	for _, rule := range rules {
+		if err := rule.Valid(); err != nil {
+			return err
+		}
+		o.mu.Lock()
+		if _, exist := o.rule[rule.Name]; exist {
+			o.mu.Unlock()
+			return o.Errorf("'%s' alert rule already exist", rule.Name)
+		}
+		o.rule[rule.Name] = rule.copy()
+		o.mu.Unlock()
+	}
+	return nil
+}
+
+func (o *Orchestrator) RemoveAlertRule(name string) error {
+	o.mu.Lock()
+	if _, exist := o.rule[name]; !exist {
+		o.mu.Unlock()
+		return o.Errorf("'%s' alert rule is not exist", name)
+	}
+	delete(o.rule, name)
+	resolved := []*Alert{}
+	for key, state := range o.ruleState {
+		if !strings.HasPrefix(key, name+"/") {
+			continue
+		}
+		if state.notified {
+			resolved = append(resolved, state.alert.resolve())
+		}
+		delete(o.ruleState, key)
+	}
+	o.mu.Unlock()
+	for _, alert := range resolved {
+		o.fireAlert(alert)
+	}
+	return nil
+}
+
+func (o *Orchestrator) AlertRules() []*AlertRule {
+	o.mu.RLock()
+	rules := []*AlertRule{}
+	for _, rule := range o.rule {
+		rules = append(rules, rule.copy())
+	}
+	o.mu.RUnlock()
+	return rules
+}
+
+// Alerts returns firing alerts
+func (o *Orchestrator) Alerts() []*Alert {
+	o.mu.RLock()
+	alerts := []*Alert{}
+	for _, state := range o.ruleState {
+		if state.firing {
+			cp := *state.alert
+			alerts = append(alerts, &cp)
+		}
+	}
+	o.mu.RUnlock()
+	return alerts
+}
+
+func (o *Orchestrator) AddSilence(silence *Silence) (*Silence, error) {
+	if err := silence.Valid(); err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	o.silenceID++
+	cp := *silence
+	cp.ID = strconv.FormatUint(o.silenceID, 10)
+	o.silence[cp.ID] = &cp
+	o.mu.Unlock()
+	o.logf(INFO, "silence #%s has been added until %s", cp.ID, cp.EndsAt.Format(time.RFC3339))
+	result := cp
+	return &result, nil
+}
+
+func (o *Orchestrator) RemoveSilence(id string) error {
+	o.mu.Lock()
+	if _, exist := o.silence[id]; !exist {
+		o.mu.Unlock()
+		return o.Errorf("silence #%s is not exist", id)
+	}
+	delete(o.silence, id)
+	o.mu.Unlock()
+	return nil
+}
+
+// Silences returns silences which are not expired
+func (o *Orchestrator) Silences() []*Silence {
+	now := time.Now()
+	o.mu.Lock()
+	silences := []*Silence{}
+	for id, silence := range o.silence {
+		if !now.Before(silence.EndsAt) {
+			delete(o.silence, id)
+			continue
+		}
+		cp := *silence
+		silences = append(silences, &cp)
+	}
+	o.mu.Unlock()
+	return silences
+}
+
+func (o *Orchestrator) AddMaintenanceWindows(windows ...*MaintenanceWindow) error {
+	for _, window := range windows {
+		if err := window.Valid(); err != nil {
+			return err
+		}
+		o.mu.Lock()
+		if _, exist := o.maintenance[window.Name]; exist {
+			o.mu.Unlock()
+			return o.Errorf("'%s' maintenance window already exist", window.Name)
+		}
+		o.maintenance[window.Name] = window.copy()
+		o.mu.Unlock()
+	}
+	return nil
+}
+
+func (o *Orchestrator) RemoveMaintenanceWindow(name string) error {
+	o.mu.Lock()
+	if _, exist := o.maintenance[name]; !exist {
+		o.mu.Unlock()
+		return o.Errorf("'%s' maintenance window is not exist", name)
+	}
+	delete(o.maintenance, name)
+	o.mu.Unlock()
+	return nil
+}
+
+func (o *Orchestrator) MaintenanceWindows() []*MaintenanceWindow {
+	o.mu.RLock()
+	windows := []*MaintenanceWindow{}
+	for _, window := range o.maintenance {
+		windows = append(windows, window.copy())
+	}
+	o.mu.RUnlock()
+	return windows
+}
+
+// InMaintenance returns true if service (on node if it is set) is under active maintenance window
+func (o *Orchestrator) InMaintenance(serviceName, nodeName string) bool {
+	now := time.Now()
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for _, window := range o.maintenance {
+		if window.Active(now) && window.Match(serviceName, nodeName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Suppressed returns true if alert is silenced or its service is under maintenance
+func (o *Orchestrator) Suppressed(alert *Alert) bool {
+	if o.InMaintenance(alert.Service, alert.Node) {
+		return true
+	}
+	now := time.Now()
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for _, silence := range o.silence {
+		if silence.Active(now) && silence.Match(alert) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Alert) resolve() *Alert {
+	cp := *a
+	cp.Resolved = true
+	cp.Time = time.Now()
+	cp.Message = fmt.Sprintf("'%s' alert of '%s' service has been resolved", a.Rule, a.Service)
+	return &cp
+}
+
+// evaluateRules evaluates alert rules against service status
+func (o *Orchestrator) evaluateRules(serviceName string, status *ServiceStatusInfo) {
+	type ruleAlert struct {
+		key   string
+		alert *Alert
+	}
+	now := time.Now()
+	alerts := []ruleAlert{}
+	o.mu.Lock()
+	for _, rule := range o.rule {
+		if rule.Service != "" && rule.Service != serviceName {
+			continue
+		}
+		key := rule.Name + "/" + serviceName
+		state, exist := o.ruleState[key]
+		matched, nodes := rule.match(status)
+		if !matched {
+			if exist {
+				if state.notified {
+					alerts = append(alerts, ruleAlert{key, state.alert.resolve()})
+				}
+				delete(o.ruleState, key)
+			}
+			continue
+		}
+		if !exist {
+			state = &ruleState{since: now}
+			o.ruleState[key] = state
+		}
+		if now.Sub(state.since) < time.Duration(rule.ForSeconds)*time.Second {
+			continue
+		}
+		if !state.firing {
+			state.firing = true
+			state.alert = &Alert{
+				Key:      "rule/" + key,
+				Rule:     rule.Name,
+				Severity: rule.Severity,
+				Service:  serviceName,
+				Status:   status.ServiceStatus,
+				Time:     now,
+				Message:  fmt.Sprintf("'%s' rule: '%s' service is %s", rule.Name, serviceName, status.ServiceStatus),
+			}
+			if rule.MinNodes > 0 {
+				state.alert.Message = fmt.Sprintf("'%s' rule: '%s' service is matched on %d of %d nodes %v", rule.Name, serviceName, len(nodes), len(status.NodeStatus), nodes)
+			}
+			if len(nodes) == 1 {
+				state.alert.Node = nodes[0]
+			}
+		}
+		if !state.notified {
+			alerts = append(alerts, ruleAlert{key, state.alert})
+		}
+	}
+	o.mu.Unlock()
+	for _, a := range alerts {
+		if !a.alert.Resolved {
+			if o.Suppressed(a.alert) {
+				continue
+			}
+			o.mu.Lock()
+			if state, exist := o.ruleState[a.key]; exist {
+				state.notified = true
+			}
+			o.mu.Unlock()
+		}
+		o.fireAlert(a.alert)
+	}
+}
+
+// fireAlert logs alert, publishes it as event and passes it to notifiers
+func (o *Orchestrator) fireAlert(alert *Alert) {
+	switch {
+	case alert.Resolved:
+		o.logf(INFO, alert.String())
+		o.publish(Event{Type: EventAlertResolved, Service: alert.Service, Node: alert.Node, Alert: alert})
+	case alert.Severity == SeverityCritical:
+		o.logf(ERROR, alert.String())
+		o.publish(Event{Type: EventAlertFiring, Service: alert.Service, Node: alert.Node, Alert: alert})
+	default:
+		o.logf(WARNING, alert.String())
+		o.publish(Event{Type: EventAlertFiring, Service: alert.Service, Node: alert.Node, Alert: alert})
+	}
+	o.notify(alert)
+}
+
+// notify passes alert to notifiers without blocking
+func (o *Orchestrator) notify(alert *Alert) {
+	o.mu.Lock()
+	for _, routine := range o.notifier {
+		if len(routine.policy.Services) > 0 && !containsString(routine.policy.Services, alert.Service) {
+			continue
+		}
+		select {
+		case routine.alerts <- alert:
+		default:
+		}
+	}
+	o.mu.Unlock()
+}
@@ -0,0 +1,64 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRemoveAlertRuleDropsPendingState(t *testing.T) {
+	o := NewOrchestrator()
+	if err := o.AddAlertRules(&AlertRule{Name: "down", ForSeconds: 60}); err != nil {
+		t.Fatal(err)
+	}
+	o.evaluateRules("a", &ServiceStatusInfo{ServiceStatus: ServiceStateInactive}) // pending for 60s
+	if err := o.RemoveAlertRule("down"); err != nil {
+		t.Fatal(err)
+	}
+	o.mu.RLock()
+	states := len(o.ruleState)
+	o.mu.RUnlock()
+	if states != 0 {
+		t.Errorf("%d states of removed rule are left", states)
+	}
+}
+
+func TestMaintenanceWindowMatch(t *testing.T) {
+	tests := []struct {
+		window  MaintenanceWindow
+		service string
+		node    string
+		match   bool
+	}{
+		{MaintenanceWindow{}, "a", "", true},
+		{MaintenanceWindow{}, "a", "n1", true},
+		{MaintenanceWindow{Services: []string{"a"}}, "a", "", true},
+		{MaintenanceWindow{Services: []string{"a"}}, "a", "n1", true},
+		{MaintenanceWindow{Services: []string{"a"}}, "b", "", false},
+		{MaintenanceWindow{Nodes: []string{"n1"}}, "a", "n1", true},
+		{MaintenanceWindow{Nodes: []string{"n1"}}, "a", "n2", false},
+		{MaintenanceWindow{Nodes: []string{"n1"}}, "a", "", false},
+		{MaintenanceWindow{Services: []string{"a"}, Nodes: []string{"n1"}}, "a", "n1", true},
+		{MaintenanceWindow{Services: []string{"a"}, Nodes: []string{"n1"}}, "b", "n1", false},
+		{MaintenanceWindow{Services: []string{"a"}, Nodes: []string{"n1"}}, "a", "", false},
+	}
+	for _, test := range tests {
+		if match := test.window.Match(test.service, test.node); match != test.match {
+			t.Errorf("window of services %v and nodes %v: '%s' service on '%s' node: match=%t, expected %t",
+				test.window.Services, test.window.Nodes, test.service, test.node, match, test.match)
+		}
+	}
+}
+
+func TestNodeMaintenanceDoesNotSuppressServiceAlert(t *testing.T) {
+	o := NewOrchestrator()
+	window := &MaintenanceWindow{Name: "n1", Nodes: []string{"n1"}, StartsAt: time.Now().Add(-time.Minute), EndsAt: time.Now().Add(time.Hour)}
+	if err := o.AddMaintenanceWindows(window); err != nil {
+		t.Fatal(err)
+	}
+	if o.Suppressed(&Alert{Rule: "nodes", Service: "a"}) {
+		t.Error("alert of service is suppressed by maintenance of one node")
+	}
+	if !o.Suppressed(&Alert{Rule: "nodes", Service: "a", Node: "n1"}) {
+		t.Error("alert of node under maintenance is not suppressed")
+	}
+}
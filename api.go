@@ -1,8 +1,13 @@
 package orchestrator
 
 import (
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
@@ -20,14 +25,46 @@ type ServiceStatusInfoResponse struct {
 type Server struct {
 	*echo.Echo
 	Orchestrator *Orchestrator
+	ExecToken    string // bearer token of exec endpoint, exec is disabled if empty
+}
+
+type BodyWithCommand struct {
+	Command string
+}
+
+type CommandOutput struct {
+	Output string
 }
 
 type BodyWithPassPhrase struct {
 	PassPhrase string
 }
 
+type BodyWithServices struct {
+	Services []string
+}
+
+type RolloutRequest struct {
+	ServiceName string
+	RollingPolicy
+}
+
+type CanaryRequest struct {
+	ServiceName string
+	CanaryPolicy
+}
+
+type BlueGreenRequest struct {
+	ServiceName string
+	BlueGreenPolicy
+}
+
+type BodyWithDesiredState struct {
+	State string // running / stopped, empty to unset
+}
+
 func (o *Orchestrator) Server() *Server {
-	s := &Server{echo.New(), o}
+	s := &Server{Echo: echo.New(), Orchestrator: o}
 	s.HideBanner = true
 	s.HidePort = true
 	// INFO
@@ -37,17 +74,60 @@ func (o *Orchestrator) Server() *Server {
 	s.PUT("/orchestrator/services", s.UpdateServiceController)
 	s.POST("/orchestrator/services/:ServiceName", s.StartServiceStatusRoutineByNameController)
 	s.GET("/orchestrator/services/:ServiceName", s.GetServiceByNameController)
+	// SERVICES: STATUS ROUTINES
+	s.GET("/orchestrator/routines", s.GetStatusRoutinesController)
+	s.POST("/orchestrator/routines/:ServiceName/pause", s.PauseStatusRoutineController)
+	s.POST("/orchestrator/routines/:ServiceName/resume", s.ResumeStatusRoutineController)
+	s.POST("/orchestrator/routines/:ServiceName/trigger", s.TriggerStatusCheckController)
 	// SERVICES: START / STOP
 	s.POST("/orchestrator/services/:ServiceName/:NodeName", s.StartServiceByNameController)
 	s.DELETE("/orchestrator/services/:ServiceName/:NodeName", s.StopServiceByNameController)
+	s.GET("/orchestrator/services/:ServiceName/:NodeName/logs", s.GetServiceLogsController)
+	// SERVICES: DESIRED STATE
+	s.PUT("/orchestrator/services/:ServiceName/:NodeName", s.SetDesiredStateController)
+	s.GET("/orchestrator/reconcile", s.GetReconcilePlanController)
+	s.POST("/orchestrator/reconcile", s.ReconcileController)
+	// CONFIGURATION
+	s.POST("/orchestrator/config/reload", s.ReloadConfigController)
+	// SERVICES: GROUP START / STOP IN DEPENDENCY ORDER
+	s.POST("/orchestrator/group/start", s.StartServicesController)
+	s.POST("/orchestrator/group/stop", s.StopServicesController)
+	// JOBS: ROLLING RESTART / DEPLOY
+	s.GET("/orchestrator/jobs", s.GetJobsController)
+	s.POST("/orchestrator/jobs/rollout", s.RolloutController)
+	s.POST("/orchestrator/jobs/canary", s.CanaryController)
+	s.POST("/orchestrator/jobs/bluegreen", s.BlueGreenController)
+	s.GET("/orchestrator/jobs/:JobID", s.GetJobByIDController)
+	s.DELETE("/orchestrator/jobs/:JobID", s.CancelJobController)
 	// NODES
 	s.GET("/orchestrator/nodes", s.GetNodesController)
+	s.PUT("/orchestrator/nodes", s.UpdateNodeController)
 	s.GET("/orchestrator/nodes/:NodeName", s.GetNodeByNameController)
 	s.POST("/orchestrator/nodes/:NodeName", s.ConnectToNodeByNameController)
 	s.DELETE("/orchestrator/nodes/:NodeName", s.DisconnectNodeByNameController)
+	s.POST("/orchestrator/nodes/:NodeName/exec", s.ExecController)
 	// STATUSES
 	s.GET("/orchestrator/statuses", s.GetServiceStatusesController)
 	s.GET("/orchestrator/statuses/:ServiceName", s.GetServiceStatusByNameController)
+	s.GET("/orchestrator/statuses/:ServiceName/history", s.GetServiceStatusHistoryByNameController)
+	// EVENTS
+	s.GET("/orchestrator/events", s.StreamEventsController)
+	// WEBHOOKS
+	s.GET("/orchestrator/webhooks", s.GetWebhooksController)
+	s.POST("/orchestrator/webhooks", s.AddWebhookController)
+	s.GET("/orchestrator/webhooks/deadletters", s.GetDeadLettersController)
+	s.DELETE("/orchestrator/webhooks/:WebhookName", s.RemoveWebhookController)
+	// ALERTS
+	s.GET("/orchestrator/alerts", s.GetAlertsController)
+	s.GET("/orchestrator/alerts/rules", s.GetAlertRulesController)
+	s.POST("/orchestrator/alerts/rules", s.AddAlertRuleController)
+	s.DELETE("/orchestrator/alerts/rules/:RuleName", s.RemoveAlertRuleController)
+	s.GET("/orchestrator/silences", s.GetSilencesController)
+	s.POST("/orchestrator/silences", s.AddSilenceController)
+	s.DELETE("/orchestrator/silences/:SilenceID", s.RemoveSilenceController)
+	s.GET("/orchestrator/maintenances", s.GetMaintenanceWindowsController)
+	s.POST("/orchestrator/maintenances", s.AddMaintenanceWindowController)
+	s.DELETE("/orchestrator/maintenances/:MaintenanceName", s.RemoveMaintenanceWindowController)
 
 	s.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		ExposeHeaders:    []string{"Server", "Content-Type", "Content-Disposition"},
@@ -109,6 +189,58 @@ func (s *Server) StartServiceStatusRoutineByNameController(c echo.Context) error
 	return c.JSON(http.StatusOK, srv)
 }
 
+/*
+GetStatusRoutinesController - Returns running status routines
+@url /orchestrator/routines
+@method GET
+@response []RoutineInfo
+@response-type application/json
+*/
+func (s *Server) GetStatusRoutinesController(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.Orchestrator.StatusRoutines())
+}
+
+/*
+PauseStatusRoutineController - Pauses periodic status checks of service
+@url /orchestrator/routines/<ServiceName>/pause
+@method POST
+@response-type text/plain
+*/
+func (s *Server) PauseStatusRoutineController(c echo.Context) error {
+	return s.routineController(c, s.Orchestrator.PauseStatusRoutine)
+}
+
+/*
+ResumeStatusRoutineController - Resumes periodic status checks of service
+@url /orchestrator/routines/<ServiceName>/resume
+@method POST
+@response-type text/plain
+*/
+func (s *Server) ResumeStatusRoutineController(c echo.Context) error {
+	return s.routineController(c, s.Orchestrator.ResumeStatusRoutine)
+}
+
+/*
+TriggerStatusCheckController - Checks service status immediately
+@url /orchestrator/routines/<ServiceName>/trigger
+@method POST
+@response-type text/plain
+*/
+func (s *Server) TriggerStatusCheckController(c echo.Context) error {
+	return s.routineController(c, s.Orchestrator.TriggerStatusCheck)
+}
+
+func (s *Server) routineController(c echo.Context, action func(serviceName string) error) error {
+	name := c.ParamValues()
+	if len(name) != 1 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind url parameter"})
+	}
+	if err := action(name[0]); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
 /*
 UpdateServiceController - Updates service by ServiceName
 @url /orchestrator/services
@@ -125,16 +257,15 @@ func (s *Server) UpdateServiceController(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, JSONMessage{Message: err.Error()})
 	}
-	srv.TimeoutSeconds = request.TimeoutSeconds
-	srv.HTTPAccess = request.HTTPAccess
-	srv.URL = request.URL
-	if err := srv.Valid(); err != nil {
+	info := srv.ServiceInfo // snapshot, changes are applied by UpdateService only
+	info.TimeoutSeconds = request.TimeoutSeconds
+	info.Schedule = request.Schedule
+	info.HTTPAccess = request.HTTPAccess
+	info.URL = request.URL
+	if err := s.Orchestrator.UpdateService(&info); err != nil {
 		return c.JSON(http.StatusBadRequest, JSONMessage{Message: err.Error()})
 	}
-	if err := s.Orchestrator.RemoveService(request.ServiceName); err != nil {
-		return c.JSON(http.StatusBadRequest, JSONMessage{Message: err.Error()})
-	}
-	if err := s.Orchestrator.RegistrateServices(srv); err != nil {
+	if srv, err = s.Orchestrator.GetService(request.ServiceName); err != nil {
 		return c.JSON(http.StatusInternalServerError, JSONMessage{Message: err.Error()})
 	}
 	return c.JSON(http.StatusOK, srv)
@@ -198,6 +329,251 @@ func (s *Server) StopServiceByNameController(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
+/*
+SetDesiredStateController - Sets desired state of service on node
+@url /orchestrator/services/<ServiceName>/<NodeName>
+@method PUT
+@request BodyWithDesiredState
+@response-type text/plain
+*/
+func (s *Server) SetDesiredStateController(c echo.Context) error {
+	param := c.ParamValues()
+	if len(param) != 2 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind url parameters"})
+	}
+	body := new(BodyWithDesiredState)
+	if err := c.Bind(body); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	if err := s.Orchestrator.SetDesiredState(param[0], param[1], body.State); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+/*
+GetReconcilePlanController - Returns drift of services from desired states
+@url /orchestrator/reconcile
+@method GET
+@response ReconcilePlan
+@response-type application/json
+*/
+func (s *Server) GetReconcilePlanController(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.Orchestrator.Plan())
+}
+
+/*
+ReconcileController - Converges services to desired states, nothing is changed with dryRun=true
+@url /orchestrator/reconcile?dryRun=<bool>
+@method POST
+@response ReconcilePlan
+@response-type application/json
+*/
+func (s *Server) ReconcileController(c echo.Context) error {
+	dryRun := false
+	if param := c.QueryParam("dryRun"); param != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(param); err != nil {
+			return c.JSON(http.StatusBadRequest, JSONMessage{"Can't parse dryRun parameter"})
+		}
+	}
+	return c.JSON(http.StatusOK, s.Orchestrator.Reconcile(dryRun))
+}
+
+/*
+ReloadConfigController - Reloads configuration file and applies its changes, nothing is changed with dryRun=true
+@url /orchestrator/config/reload?dryRun=<bool>
+@method POST
+@response ConfigDiff
+@response-type application/json
+*/
+func (s *Server) ReloadConfigController(c echo.Context) error {
+	dryRun := false
+	if param := c.QueryParam("dryRun"); param != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(param); err != nil {
+			return c.JSON(http.StatusBadRequest, JSONMessage{"Can't parse dryRun parameter"})
+		}
+	}
+	diff, err := s.Orchestrator.ReloadConfig(dryRun)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.JSON(http.StatusOK, diff)
+}
+
+/*
+GetServiceLogsController - Returns last lines of service logs on node
+@url /orchestrator/services/<ServiceName>/<NodeName>/logs?lines=<int>
+@method GET
+@response-type text/plain
+*/
+func (s *Server) GetServiceLogsController(c echo.Context) error {
+	param := c.ParamValues()
+	if len(param) != 2 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind url parameters"})
+	}
+	lines := DefaultLogLines
+	if value := c.QueryParam("lines"); value != "" {
+		var err error
+		if lines, err = strconv.Atoi(value); err != nil {
+			return c.JSON(http.StatusBadRequest, JSONMessage{"Can't parse lines parameter"})
+		}
+	}
+	out, err := s.Orchestrator.ServiceLogs(param[1], param[0], lines)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, JSONMessage{err.Error()})
+	}
+	return c.Blob(http.StatusOK, echo.MIMETextPlainCharsetUTF8, out)
+}
+
+/*
+StartServicesController - Starts services with their dependencies in dependency order
+@url /orchestrator/group/start
+@method POST
+@request BodyWithServices
+@response-type text/plain
+*/
+func (s *Server) StartServicesController(c echo.Context) error {
+	body := new(BodyWithServices)
+	if err := c.Bind(body); err != nil || len(body.Services) < 1 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind services"})
+	}
+	if err := s.Orchestrator.StartServices(body.Services...); err != nil {
+		return c.JSON(http.StatusInternalServerError, JSONMessage{
+			fmt.Sprintf("Orchestrator: group starting error: %s", err.Error()),
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+/*
+StopServicesController - Stops services with their dependents in reverse dependency order
+@url /orchestrator/group/stop
+@method POST
+@request BodyWithServices
+@response-type text/plain
+*/
+func (s *Server) StopServicesController(c echo.Context) error {
+	body := new(BodyWithServices)
+	if err := c.Bind(body); err != nil || len(body.Services) < 1 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind services"})
+	}
+	if err := s.Orchestrator.StopServices(body.Services...); err != nil {
+		return c.JSON(http.StatusInternalServerError, JSONMessage{
+			fmt.Sprintf("Orchestrator: group stopping error: %s", err.Error()),
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+/*
+GetJobsController - Returns jobs
+@url /orchestrator/jobs
+@method GET
+@response []Job
+@response-type application/json
+*/
+func (s *Server) GetJobsController(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.Orchestrator.Jobs())
+}
+
+/*
+RolloutController - Starts rolling restart or rolling deploy (if Package is defined) job
+@url /orchestrator/jobs/rollout
+@method POST
+@request RolloutRequest
+@response Job
+@response-type application/json
+*/
+func (s *Server) RolloutController(c echo.Context) error {
+	request := new(RolloutRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	job, err := s.Orchestrator.Rollout(request.ServiceName, request.RollingPolicy)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.JSON(http.StatusAccepted, job)
+}
+
+/*
+CanaryController - Starts canary deployment job
+@url /orchestrator/jobs/canary
+@method POST
+@request CanaryRequest
+@response Job
+@response-type application/json
+*/
+func (s *Server) CanaryController(c echo.Context) error {
+	request := new(CanaryRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	job, err := s.Orchestrator.Canary(request.ServiceName, request.CanaryPolicy)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.JSON(http.StatusAccepted, job)
+}
+
+/*
+BlueGreenController - Starts blue/green deployment job
+@url /orchestrator/jobs/bluegreen
+@method POST
+@request BlueGreenRequest
+@response Job
+@response-type application/json
+*/
+func (s *Server) BlueGreenController(c echo.Context) error {
+	request := new(BlueGreenRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	job, err := s.Orchestrator.BlueGreen(request.ServiceName, request.BlueGreenPolicy)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.JSON(http.StatusAccepted, job)
+}
+
+/*
+GetJobByIDController - Returns job by JobID
+@url /orchestrator/jobs/<JobID>
+@method GET
+@response Job
+@response-type application/json
+*/
+func (s *Server) GetJobByIDController(c echo.Context) error {
+	id := c.ParamValues()
+	if len(id) != 1 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind url parameter"})
+	}
+	job, err := s.Orchestrator.GetJob(id[0])
+	if err != nil {
+		return c.JSON(http.StatusNotFound, JSONMessage{err.Error()})
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+/*
+CancelJobController - Cancels running job by JobID
+@url /orchestrator/jobs/<JobID>
+@method DELETE
+@response-type text/plain
+*/
+func (s *Server) CancelJobController(c echo.Context) error {
+	id := c.ParamValues()
+	if len(id) != 1 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind url parameter"})
+	}
+	if err := s.Orchestrator.CancelJob(id[0]); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
 /*
 GetNodesController - Returns nodes
 @url /orchestrator/nodes
@@ -209,6 +585,29 @@ func (s *Server) GetNodesController(c echo.Context) error {
 	return c.JSON(http.StatusOK, s.Orchestrator.copyNodesAsArray())
 }
 
+/*
+UpdateNodeController - Updates node by NodeName
+@url /orchestrator/nodes
+@method PUT
+@request NodeInfo
+@response Node
+@response-type application/json
+*/
+func (s *Server) UpdateNodeController(c echo.Context) error {
+	request := new(NodeInfo)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{Message: err.Error()})
+	}
+	if err := s.Orchestrator.UpdateNode(request); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{Message: err.Error()})
+	}
+	node, err := s.Orchestrator.GetNode(request.NodeName)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, JSONMessage{Message: err.Error()})
+	}
+	return c.JSON(http.StatusOK, node)
+}
+
 /*
 GetNodeByNameController - Returns node by NodeName
 @url /orchestrator/nodes/<NodeName>
@@ -279,6 +678,37 @@ func (s *Server) DisconnectNodeByNameController(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
+/*
+ExecController - Runs command on node, requires "Authorization: Bearer <ExecToken>", disabled if ExecToken is empty
+@url /orchestrator/nodes/<NodeName>/exec
+@method POST
+@request BodyWithCommand
+@response CommandOutput
+@response-type application/json
+*/
+func (s *Server) ExecController(c echo.Context) error {
+	if s.ExecToken == "" {
+		return c.JSON(http.StatusForbidden, JSONMessage{"Exec is disabled"})
+	}
+	token := strings.TrimPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.ExecToken)) != 1 {
+		return c.JSON(http.StatusUnauthorized, JSONMessage{"Invalid exec token"})
+	}
+	name := c.ParamValues()
+	if len(name) != 1 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind url parameter"})
+	}
+	body := new(BodyWithCommand)
+	if err := c.Bind(body); err != nil || body.Command == "" {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind command"})
+	}
+	out, err := s.Orchestrator.RunCommand(name[0], body.Command)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, JSONMessage{err.Error()})
+	}
+	return c.JSON(http.StatusOK, CommandOutput{string(out)})
+}
+
 /*
 GetServiceStatusesController - Returns services statuses
 @url /orchestrator/statuses
@@ -313,3 +743,355 @@ func (s *Server) GetServiceStatusByNameController(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, ServiceStatusInfoResponse{srv.ServiceName, srv.ServiceStatus})
 }
+
+/*
+GetServiceStatusHistoryByNameController - Returns service status history with uptime report
+@url /orchestrator/statuses/<ServiceName>/history?from=<RFC3339>&to=<RFC3339>
+@method GET
+@response ServiceHistory
+@response-type application/json
+*/
+func (s *Server) GetServiceStatusHistoryByNameController(c echo.Context) error {
+	name := c.ParamValues()
+	if len(name) != 1 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind url parameter"})
+	}
+	var from, to time.Time
+	var err error
+	if param := c.QueryParam("from"); param != "" {
+		if from, err = time.Parse(time.RFC3339, param); err != nil {
+			return c.JSON(http.StatusBadRequest, JSONMessage{fmt.Sprintf("Can't parse 'from' query parameter: %s", err.Error())})
+		}
+	}
+	if param := c.QueryParam("to"); param != "" {
+		if to, err = time.Parse(time.RFC3339, param); err != nil {
+			return c.JSON(http.StatusBadRequest, JSONMessage{fmt.Sprintf("Can't parse 'to' query parameter: %s", err.Error())})
+		}
+	}
+	history, err := s.Orchestrator.History(name[0], from, to)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.JSON(http.StatusOK, history)
+}
+
+/*
+StreamEventsController - Streams events as Server-Sent Events, all events except status-checked are streamed by default
+@url /orchestrator/events?service=<ServiceName>,...&node=<NodeName>,...&type=<EventType>,...&lastEventId=<ID>&replay=<bool>
+@method GET
+@header Last-Event-ID - resumes stream after event with this ID, stream is resynced from the beginning if ID is unknown
+@param replay - recent events are streamed first (default true)
+@response EventRecord
+@response-type text/event-stream
+*/
+func (s *Server) StreamEventsController(c echo.Context) error {
+	filter := &EventFilter{
+		Services: splitQueryParam(c.QueryParam("service")),
+		Nodes:    splitQueryParam(c.QueryParam("node")),
+		Types:    splitQueryParam(c.QueryParam("type")),
+		Policy:   DropOldest,
+	}
+	if len(filter.Types) < 1 {
+		filter.Types = NotableEventTypes
+	}
+	lastID := c.Request().Header.Get("Last-Event-ID")
+	if param := c.QueryParam("lastEventId"); param != "" {
+		lastID = param
+	}
+	var last uint64
+	if lastID != "" {
+		id, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, JSONMessage{fmt.Sprintf("Can't parse last event ID: %s", err.Error())})
+		}
+		last = id
+	}
+	replay := true
+	if param := c.QueryParam("replay"); param != "" {
+		var err error
+		if replay, err = strconv.ParseBool(param); err != nil {
+			return c.JSON(http.StatusBadRequest, JSONMessage{"Can't parse replay parameter"})
+		}
+	}
+	events, cancel := s.Orchestrator.Subscribe(filter) // subscribes before replay to not miss events
+	defer cancel()
+	if last > s.Orchestrator.LastEventID() { // event IDs have been restarted with orchestrator
+		last = 0
+	}
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.Header().Set("Connection", "keep-alive")
+	response.WriteHeader(http.StatusOK)
+	response.Flush()
+	for _, e := range s.Orchestrator.EventsSince(last, filter) {
+		if replay {
+			if err := writeServerSentEvent(response, &e); err != nil {
+				return nil
+			}
+		}
+		last = e.ID
+	}
+	ping := time.NewTicker(15 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-ping.C:
+			if _, err := fmt.Fprint(response, ": ping\n\n"); err != nil {
+				return nil
+			}
+			response.Flush()
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if e.ID <= last { // already replayed
+				continue
+			}
+			if err := writeServerSentEvent(response, &e); err != nil {
+				return nil
+			}
+			last = e.ID
+		}
+	}
+}
+
+func writeServerSentEvent(response *echo.Response, e *Event) error {
+	data, err := json.Marshal(e.record())
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(response, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+		return err
+	}
+	response.Flush()
+	return nil
+}
+
+func splitQueryParam(param string) []string {
+	values := []string{}
+	for _, value := range strings.Split(param, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+/*
+GetWebhooksController - Returns webhooks
+@url /orchestrator/webhooks
+@method GET
+@response []Webhook
+@response-type application/json
+*/
+func (s *Server) GetWebhooksController(c echo.Context) error {
+	webhooks := s.Orchestrator.Webhooks()
+	for _, webhook := range webhooks {
+		webhook.maskSecret()
+	}
+	return c.JSON(http.StatusOK, webhooks)
+}
+
+/*
+AddWebhookController - Adds webhook
+@url /orchestrator/webhooks
+@method POST
+@request Webhook
+@response Webhook
+@response-type application/json
+*/
+func (s *Server) AddWebhookController(c echo.Context) error {
+	webhook := new(Webhook)
+	if err := c.Bind(webhook); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	if err := s.Orchestrator.AddWebhooks(webhook); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	webhook.maskSecret()
+	return c.JSON(http.StatusOK, webhook)
+}
+
+/*
+RemoveWebhookController - Removes webhook by WebhookName
+@url /orchestrator/webhooks/<WebhookName>
+@method DELETE
+@response-type text/plain
+*/
+func (s *Server) RemoveWebhookController(c echo.Context) error {
+	name := c.ParamValues()
+	if len(name) != 1 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind url parameter"})
+	}
+	if err := s.Orchestrator.RemoveWebhook(name[0]); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+/*
+GetDeadLettersController - Returns events which have not been delivered by webhooks
+@url /orchestrator/webhooks/deadletters
+@method GET
+@response []DeadLetter
+@response-type application/json
+*/
+func (s *Server) GetDeadLettersController(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.Orchestrator.DeadLetters())
+}
+
+/*
+GetAlertsController - Returns firing alerts
+@url /orchestrator/alerts
+@method GET
+@response []Alert
+@response-type application/json
+*/
+func (s *Server) GetAlertsController(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.Orchestrator.Alerts())
+}
+
+/*
+GetAlertRulesController - Returns alert rules
+@url /orchestrator/alerts/rules
+@method GET
+@response []AlertRule
+@response-type application/json
+*/
+func (s *Server) GetAlertRulesController(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.Orchestrator.AlertRules())
+}
+
+/*
+AddAlertRuleController - Adds alert rule
+@url /orchestrator/alerts/rules
+@method POST
+@request AlertRule
+@response AlertRule
+@response-type application/json
+*/
+func (s *Server) AddAlertRuleController(c echo.Context) error {
+	rule := new(AlertRule)
+	if err := c.Bind(rule); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	if err := s.Orchestrator.AddAlertRules(rule); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.JSON(http.StatusOK, rule)
+}
+
+/*
+RemoveAlertRuleController - Removes alert rule by RuleName
+@url /orchestrator/alerts/rules/<RuleName>
+@method DELETE
+@response-type text/plain
+*/
+func (s *Server) RemoveAlertRuleController(c echo.Context) error {
+	name := c.ParamValues()
+	if len(name) != 1 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind url parameter"})
+	}
+	if err := s.Orchestrator.RemoveAlertRule(name[0]); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+/*
+GetSilencesController - Returns silences which are not expired
+@url /orchestrator/silences
+@method GET
+@response []Silence
+@response-type application/json
+*/
+func (s *Server) GetSilencesController(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.Orchestrator.Silences())
+}
+
+/*
+AddSilenceController - Adds silence
+@url /orchestrator/silences
+@method POST
+@request Silence
+@response Silence
+@response-type application/json
+*/
+func (s *Server) AddSilenceController(c echo.Context) error {
+	request := new(Silence)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	silence, err := s.Orchestrator.AddSilence(request)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.JSON(http.StatusOK, silence)
+}
+
+/*
+RemoveSilenceController - Removes silence by SilenceID
+@url /orchestrator/silences/<SilenceID>
+@method DELETE
+@response-type text/plain
+*/
+func (s *Server) RemoveSilenceController(c echo.Context) error {
+	id := c.ParamValues()
+	if len(id) != 1 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind url parameter"})
+	}
+	if err := s.Orchestrator.RemoveSilence(id[0]); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+/*
+GetMaintenanceWindowsController - Returns maintenance windows
+@url /orchestrator/maintenances
+@method GET
+@response []MaintenanceWindow
+@response-type application/json
+*/
+func (s *Server) GetMaintenanceWindowsController(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.Orchestrator.MaintenanceWindows())
+}
+
+/*
+AddMaintenanceWindowController - Adds maintenance window
+@url /orchestrator/maintenances
+@method POST
+@request MaintenanceWindow
+@response MaintenanceWindow
+@response-type application/json
+*/
+func (s *Server) AddMaintenanceWindowController(c echo.Context) error {
+	window := new(MaintenanceWindow)
+	if err := c.Bind(window); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	if err := s.Orchestrator.AddMaintenanceWindows(window); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.JSON(http.StatusOK, window)
+}
+
+/*
+RemoveMaintenanceWindowController - Removes maintenance window by MaintenanceName
+@url /orchestrator/maintenances/<MaintenanceName>
+@method DELETE
+@response-type text/plain
+*/
+func (s *Server) RemoveMaintenanceWindowController(c echo.Context) error {
+	name := c.ParamValues()
+	if len(name) != 1 {
+		return c.JSON(http.StatusBadRequest, JSONMessage{"Can't bind url parameter"})
+	}
+	if err := s.Orchestrator.RemoveMaintenanceWindow(name[0]); err != nil {
+		return c.JSON(http.StatusBadRequest, JSONMessage{err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,151 @@
+package orchestrator
+
+import (
+	"errors"
+	"time"
+)
+
+// CheckPolicy sets thresholds for a single check (HTTP access or node status)
+type CheckPolicy struct {
+	Rise              int // consecutive successes before check changes state to passed
+	Fall              int // consecutive failures before check changes state to failed
+	Retries           int // retries inside one evaluation
+	RetryDelaySeconds int // delay between retries
+}
+
+// FlapDetection marks service as flapping when it changes state too often
+type FlapDetection struct {
+	WindowSeconds  int
+	MaxTransitions int // 0 -- flap detection is disabled
+}
+
+type checkState struct {
+	checks      map[string]*thresholdState
+	lastStatus  ServiceState
+	transitions []time.Time
+	flapping    bool
+}
+
+type thresholdState struct {
+	status    int
+	successes int
+	failures  int
+}
+
+func newCheckState() *checkState {
+	return &checkState{make(map[string]*thresholdState), ServiceStateUndefined, []time.Time{}, false}
+}
+
+func (p *CheckPolicy) Valid() error {
+	if p.Rise < 0 || p.Fall < 0 {
+		return errors.New("Check validation: rise and fall must not be negative")
+	}
+	if p.Retries < 0 || p.RetryDelaySeconds < 0 {
+		return errors.New("Check validation: retries and retry delay must not be negative")
+	}
+	return nil
+}
+
+func (p *CheckPolicy) rise() int {
+	if p.Rise < 1 {
+		return 1
+	}
+	return p.Rise
+}
+
+func (p *CheckPolicy) fall() int {
+	if p.Fall < 1 {
+		return 1
+	}
+	return p.Fall
+}
+
+// retry runs check until it passes or retries are over
+func (p *CheckPolicy) retry(check func() error) error {
+	err := check()
+	for i := 0; err != nil && i < p.Retries; i++ {
+		time.Sleep(time.Duration(p.RetryDelaySeconds) * time.Second)
+		err = check()
+	}
+	return err
+}
+
+func (f *FlapDetection) Valid() error {
+	if f.WindowSeconds < 0 || f.MaxTransitions < 0 {
+		return errors.New("Flap detection validation: window and transitions must not be negative")
+	}
+	if f.MaxTransitions > 0 && f.WindowSeconds < 1 {
+		return errors.New("Flap detection validation: undefined window")
+	}
+	return nil
+}
+
+// debounce applies rise/fall thresholds of policy to the raw status of check
+// and returns the stable status
+func (o *Orchestrator) debounce(serviceName, check string, policy CheckPolicy, status int) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	state, exist := o.check[serviceName]
+	if !exist {
+		state = newCheckState()
+		o.check[serviceName] = state
+	}
+	th, exist := state.checks[check]
+	if !exist { // first observation is taken as is
+		state.checks[check] = &thresholdState{status: status}
+		return status
+	}
+	if status == StatusPassed {
+		th.successes++
+		th.failures = 0
+		if th.status == StatusPassed || th.successes >= policy.rise() {
+			th.status = status
+		}
+	} else {
+		th.failures++
+		th.successes = 0
+		if th.status != StatusPassed || th.failures >= policy.fall() {
+			th.status = status
+		}
+	}
+	return th.status
+}
+
+// detectFlapping records service state transition and returns true if service is flapping
+func (o *Orchestrator) detectFlapping(serviceName string, flap FlapDetection, status ServiceState) bool {
+	o.mu.Lock()
+	state, exist := o.check[serviceName]
+	if !exist {
+		state = newCheckState()
+		o.check[serviceName] = state
+	}
+	now := time.Now()
+	if state.lastStatus != ServiceStateUndefined && state.lastStatus != status {
+		state.transitions = append(state.transitions, now)
+	}
+	state.lastStatus = status
+	window := now.Add(-time.Duration(flap.WindowSeconds) * time.Second)
+	transitions := []time.Time{}
+	for _, t := range state.transitions {
+		if t.After(window) {
+			transitions = append(transitions, t)
+		}
+	}
+	state.transitions = transitions
+	was := state.flapping
+	state.flapping = flap.MaxTransitions > 0 && len(transitions) >= flap.MaxTransitions
+	flapping := state.flapping
+	o.mu.Unlock()
+	if flapping && !was {
+		o.logf(WARNING, "'%s' service is flapping: %d transitions in %d seconds", serviceName, len(transitions), flap.WindowSeconds)
+	} else if !flapping && was {
+		o.logf(WARNING, "'%s' service is not flapping anymore", serviceName)
+	}
+	return flapping
+}
+
+func (o *Orchestrator) rmCheckState(serviceName string) {
+	o.mu.Lock()
+	delete(o.check, serviceName)
+	o.mu.Unlock()
+}
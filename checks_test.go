@@ -0,0 +1,86 @@
+package orchestrator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDebounce(t *testing.T) {
+	o := NewOrchestrator()
+	policy := CheckPolicy{Rise: 2, Fall: 3}
+	steps := []struct {
+		raw    int
+		stable int
+	}{
+		{StatusPassed, StatusPassed}, // first observation is taken as is
+		{StatusFailed, StatusPassed},
+		{StatusFailed, StatusPassed},
+		{StatusFailed, StatusFailed}, // 3 failures in a row
+		{StatusPassed, StatusFailed},
+		{StatusFailed, StatusFailed}, // successes are reset by failure
+		{StatusPassed, StatusFailed},
+		{StatusPassed, StatusPassed}, // 2 successes in a row
+	}
+	for i, step := range steps {
+		if stable := o.debounce("s", "http:check", policy, step.raw); stable != step.stable {
+			t.Errorf("step %d: %s is debounced to %s, expected %s",
+				i, CheckState(step.raw), CheckState(stable), CheckState(step.stable))
+		}
+	}
+	o.rmCheckState("s")
+	if stable := o.debounce("s", "http:check", policy, StatusFailed); stable != StatusFailed {
+		t.Errorf("state is kept after removal: %s", CheckState(stable))
+	}
+}
+
+func TestHTTPAccessRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1)%3 != 0 { // every third request succeeds
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	access := &HTTPAccess{Method: "GET", Address: server.URL, StatusCode: http.StatusOK}
+	if err := access.Check(); err == nil {
+		t.Error("check without retries has passed")
+	}
+	atomic.StoreInt32(&requests, 0)
+	access.CheckPolicy.Retries = 2
+	if err := access.Check(); err != nil {
+		t.Errorf("check with retries: %s", err.Error())
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("%d requests, expected 3", n)
+	}
+}
+
+func TestDetectFlapping(t *testing.T) {
+	o := NewOrchestrator()
+	flap := FlapDetection{WindowSeconds: 60, MaxTransitions: 3}
+	states := []ServiceState{StatusActive, StatusInactive, StatusActive, StatusActive, StatusInactive}
+	for i, state := range states {
+		flapping := o.detectFlapping("s", flap, state)
+		if expected := i == len(states)-1; flapping != expected {
+			t.Errorf("step %d: flapping=%t, expected %t", i, flapping, expected)
+		}
+	}
+	if o.detectFlapping("other", FlapDetection{}, StatusActive) || o.detectFlapping("other", FlapDetection{}, StatusInactive) {
+		t.Error("service is flapping with disabled detection")
+	}
+}
+
+func TestCheckPolicyValid(t *testing.T) {
+	if err := (&CheckPolicy{Rise: -1}).Valid(); err == nil {
+		t.Error("negative rise is valid")
+	}
+	if err := (&CheckPolicy{Retries: -1}).Valid(); err == nil {
+		t.Error("negative retries are valid")
+	}
+	if err := (&FlapDetection{MaxTransitions: 3}).Valid(); err == nil {
+		t.Error("flap detection without window is valid")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mariiatuzovska/orchestrator"
+	"github.com/urfave/cli"
+)
+
+func main() {
+	if err := newApp().Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newApp returns daemon application with its flags and commands
+func newApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = orchestrator.OrchestratorServiceType
+	app.Usage = "orchestrator daemon: checks and manages services on nodes, serves REST API"
+	app.Version = orchestrator.Version
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "config, c",
+			Usage:  "configuration file (.yaml / .yml / .json / .toml)",
+			EnvVar: "ORCHESTRATOR_CONFIG",
+		},
+		cli.StringFlag{
+			Name:   "listen, l",
+			Usage:  "listen address of REST API, overrides server address of config (default: " + orchestrator.DefaultServerAddress + ")",
+			EnvVar: "ORCHESTRATOR_LISTEN",
+		},
+		cli.StringFlag{
+			Name:   "log-level",
+			Usage:  "debug / info / warning / error, overrides log level of config (default: info)",
+			EnvVar: "ORCHESTRATOR_LOG_LEVEL",
+		},
+		cli.StringFlag{
+			Name:   "tls-cert",
+			Usage:  "TLS certificate file, overrides TLS certificate of config",
+			EnvVar: "ORCHESTRATOR_TLS_CERT",
+		},
+		cli.StringFlag{
+			Name:   "tls-key",
+			Usage:  "TLS private key file, overrides TLS key of config",
+			EnvVar: "ORCHESTRATOR_TLS_KEY",
+		},
+		cli.StringFlag{
+			Name:   "storage",
+			Usage:  "file of persisted nodes, services, statuses and events, overrides storage of config (default: nothing is persisted)",
+			EnvVar: "ORCHESTRATOR_STORAGE",
+		},
+		cli.StringFlag{
+			Name:   "exec-token",
+			Usage:  "enables exec endpoint of REST API for requests with this bearer token (default: disabled)",
+			EnvVar: "ORCHESTRATOR_EXEC_TOKEN",
+		},
+		cli.DurationFlag{
+			Name:  "watch",
+			Usage: "reload config when its file is modified, checking it every interval (0 -- disabled)",
+		},
+		cli.DurationFlag{
+			Name:  "shutdown-timeout",
+			Usage: "time of waiting for routines and requests on shutdown",
+			Value: 10 * time.Second,
+		},
+	}
+	app.Action = run
+	app.Commands = []cli.Command{
+		{
+			Name:      "validate",
+			Usage:     "validates configuration file",
+			ArgsUsage: "[config]",
+			Action:    validate,
+		},
+		installCommand,
+		uninstallCommand,
+	}
+	return app
+}
+
+// run starts orchestrator with REST API until SIGINT or SIGTERM, SIGHUP reloads config
+func run(c *cli.Context) error {
+	orch := orchestrator.NewOrchestrator()
+	level, err := orchestrator.ParseLogLevel(c.String("log-level"))
+	if err != nil {
+		return err
+	}
+	if c.IsSet("log-level") {
+		orch.OverrideLogLevel(level) // kept on reloads of config
+	} else {
+		orch.SetLogLevel(level)
+	}
+	config := new(orchestrator.Config)
+	path := c.String("config")
+	if path != "" {
+		if config, err = orch.LoadConfig(path); err != nil {
+			return err
+		}
+	}
+	storagePath := config.Storage
+	if c.IsSet("storage") {
+		storagePath = c.String("storage")
+	}
+	if storagePath != "" { // configured nodes and services are kept, their statuses and history are restored
+		storage, err := orchestrator.NewFileStorage(storagePath, config.HistoryLimit)
+		if err != nil {
+			return err
+		}
+		if err := orch.SetStorage(storage); err != nil {
+			storage.Close()
+			return err
+		}
+	}
+	address := config.Server.Address
+	if c.IsSet("listen") || address == "" {
+		address = c.String("listen")
+	}
+	if address == "" {
+		address = orchestrator.DefaultServerAddress
+	}
+	cert, key := config.Server.TLSCert, config.Server.TLSKey
+	if c.IsSet("tls-cert") || c.IsSet("tls-key") {
+		cert, key = c.String("tls-cert"), c.String("tls-key")
+	}
+	if (cert == "") != (key == "") {
+		return fmt.Errorf("both TLS certificate and key must be set")
+	}
+
+	failed := make(chan error, 1)
+	go func() { // Start returns before shutdown on failure only
+		if err := orch.Start(context.Background()); err != nil {
+			failed <- err
+		}
+	}()
+	if path != "" {
+		orch.ReloadOnSignal(syscall.SIGHUP)
+		if watch := c.Duration("watch"); watch > 0 {
+			if err := orch.WatchConfig(watch); err != nil {
+				return err
+			}
+		}
+	}
+
+	server := orch.Server()
+	server.ExecToken = c.String("exec-token")
+	stopped := make(chan error, 1)
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		var err error
+		select {
+		case s := <-sig:
+			log.Printf("%s signal has been received, shutting down", s)
+		case err = <-failed:
+			log.Printf("orchestrator has failed, shutting down: %s", err.Error())
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), c.Duration("shutdown-timeout"))
+		defer cancel()
+		if shutdownErr := server.Shutdown(ctx); err == nil {
+			err = shutdownErr
+		}
+		stopped <- err
+	}()
+
+	log.Printf("orchestrator %s is listening on %s", orchestrator.Version, address)
+	if cert != "" {
+		err = server.StartTLS(address, cert, key)
+	} else {
+		err = server.Start(address)
+	}
+	if err == http.ErrServerClosed {
+		return <-stopped // server is closed by shutdown only
+	}
+	orch.Stop() // storage is closed even if server has failed to listen
+	return err
+}
+
+// validate parses configuration file without registering it
+func validate(c *cli.Context) error {
+	path := c.Args().First()
+	if path == "" {
+		path = c.GlobalString("config")
+	}
+	if path == "" {
+		return fmt.Errorf("config file is not set")
+	}
+	config, err := orchestrator.ParseConfig(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid: %d nodes, %d services\n", path, len(config.Nodes), len(config.Services))
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/mariiatuzovska/orchestrator"
+	"github.com/urfave/cli"
+)
+
+// DefaultUnitDir is a directory of systemd units installed by administrator
+const DefaultUnitDir = "/etc/systemd/system"
+
+var unitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=Orchestrator of services on nodes
+Documentation=https://github.com/mariiatuzovska/orchestrator
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=simple
+ExecStart={{.ExecStart}}
+ExecReload=/bin/kill -HUP $MAINPID
+KillSignal=SIGTERM
+TimeoutStopSec=30
+Restart=on-failure
+RestartSec=5
+{{- if .User}}
+User={{.User}}
+{{- end}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+var installCommand = cli.Command{
+	Name:  "install",
+	Usage: "installs orchestrator as systemd unit",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "unit-dir", Usage: "directory of systemd units", Value: DefaultUnitDir},
+		cli.StringFlag{Name: "user", Usage: "user running orchestrator (default: root)"},
+		cli.BoolFlag{Name: "enable", Usage: "reloads systemd, enables and starts unit"},
+	},
+	Action: install,
+}
+
+var uninstallCommand = cli.Command{
+	Name:  "uninstall",
+	Usage: "stops, disables and removes systemd unit of orchestrator",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "unit-dir", Usage: "directory of systemd units", Value: DefaultUnitDir},
+	},
+	Action: uninstall,
+}
+
+func unitName() string {
+	return orchestrator.OrchestratorServiceType + ".service"
+}
+
+// install writes systemd unit running this binary with global flags of install command
+func install(c *cli.Context) error {
+	binary, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := []string{binary}
+	for _, flag := range []string{"config", "listen", "log-level", "tls-cert", "tls-key", "storage"} {
+		if value := c.GlobalString(flag); value != "" {
+			if flag == "config" || flag == "tls-cert" || flag == "tls-key" || flag == "storage" {
+				if value, err = filepath.Abs(value); err != nil {
+					return err
+				}
+			}
+			args = append(args, fmt.Sprintf("--%s=%s", flag, value))
+		}
+	}
+	for _, flag := range []string{"watch", "shutdown-timeout"} {
+		if c.GlobalIsSet(flag) {
+			args = append(args, fmt.Sprintf("--%s=%s", flag, c.GlobalDuration(flag)))
+		}
+	}
+	path := filepath.Join(c.String("unit-dir"), unitName())
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	for i, arg := range args {
+		args[i] = unitArg(arg)
+	}
+	err = unitTemplate.Execute(file, struct{ ExecStart, User string }{strings.Join(args, " "), c.String("user")})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s has been installed\n", path)
+	if !c.Bool("enable") {
+		fmt.Printf("run: systemctl daemon-reload && systemctl enable --now %s\n", unitName())
+		return nil
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", "--now", unitName())
+}
+
+// unitArg escapes specifiers and variables in argument of ExecStart, quotes argument with spaces or quotes
+func unitArg(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(arg) + `"`
+}
+
+func uninstall(c *cli.Context) error {
+	path := filepath.Join(c.String("unit-dir"), unitName())
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	if err := systemctl("disable", "--now", unitName()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	fmt.Printf("%s has been removed\n", path)
+	return systemctl("daemon-reload")
+}
+
+func systemctl(args ...string) error {
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %s: %s", strings.Join(args, " "), err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSystemctl puts systemctl which logs its arguments first in PATH
+func fakeSystemctl(t *testing.T, dir string) (calls func() []string, restore func()) {
+	log := filepath.Join(dir, "systemctl.log")
+	script := "#!/bin/sh\necho \"$@\" >> " + log + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "systemctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	calls = func() []string {
+		data, _ := ioutil.ReadFile(log)
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+	return calls, func() { os.Setenv("PATH", path) }
+}
+
+func TestUnitArg(t *testing.T) {
+	tests := map[string]string{
+		"--config=/etc/orchestrator.yaml": "--config=/etc/orchestrator.yaml",
+		"--listen=127.0.0.1:8080":         "--listen=127.0.0.1:8080",
+		"--config=/etc/my config.yaml":    `"--config=/etc/my config.yaml"`,
+		`--config=/etc/"quoted".yaml`:     `"--config=/etc/\"quoted\".yaml"`,
+		"--config=/etc/100%.yaml":         "--config=/etc/100%%.yaml",
+		"--config=$HOME/orchestrator.yml": "--config=$$HOME/orchestrator.yml",
+		"":                                `""`,
+	}
+	for arg, expected := range tests {
+		if escaped := unitArg(arg); escaped != expected {
+			t.Errorf("%q is escaped into %q, expected %q", arg, escaped, expected)
+		}
+	}
+}
+
+func TestInstallUninstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "orchestrator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	calls, restore := fakeSystemctl(t, dir)
+	defer restore()
+
+	err = newApp().Run([]string{"orchestrator", "--config", "orchestrator.yaml", "--storage", "state.jsonl", "--watch", "5s",
+		"install", "--unit-dir", dir, "--user", "orchestrator", "--enable"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, unitName()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unit := string(data)
+	config, _ := filepath.Abs("orchestrator.yaml")
+	storage, _ := filepath.Abs("state.jsonl")
+	for _, line := range []string{
+		"--config=" + unitArg(config),
+		"--storage=" + unitArg(storage),
+		"--watch=5s",
+		"\nUser=orchestrator\n",
+		"\nExecReload=/bin/kill -HUP $MAINPID\n",
+	} {
+		if !strings.Contains(unit, line) {
+			t.Errorf("unit has no %q:\n%s", line, unit)
+		}
+	}
+	if strings.Contains(unit, "--listen") || strings.Contains(unit, "--shutdown-timeout") {
+		t.Errorf("unit has flags which are not set:\n%s", unit)
+	}
+
+	if err := newApp().Run([]string{"orchestrator", "uninstall", "--unit-dir", dir}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, unitName())); !os.IsNotExist(err) {
+		t.Errorf("unit is not removed: %v", err)
+	}
+	expected := []string{"daemon-reload", "enable --now " + unitName(), "disable --now " + unitName(), "daemon-reload"}
+	if strings.Join(calls(), ";") != strings.Join(expected, ";") {
+		t.Errorf("systemctl calls are %q, expected %q", calls(), expected)
+	}
+	if err := newApp().Run([]string{"orchestrator", "uninstall", "--unit-dir", dir}); err == nil {
+		t.Error("unit is uninstalled twice")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "orchestrator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	valid := filepath.Join(dir, "valid.yaml")
+	invalid := filepath.Join(dir, "invalid.yaml")
+	ioutil.WriteFile(valid, []byte("nodes:\n  - {nodeName: local, os: linux}\n"), 0600)
+	ioutil.WriteFile(invalid, []byte("nodes:\n  - {nodeName: local, os: windows}\n"), 0600)
+
+	if err := newApp().Run([]string{"orchestrator", "validate", valid}); err != nil {
+		t.Error(err)
+	}
+	if err := newApp().Run([]string{"orchestrator", "--config", valid, "validate"}); err != nil {
+		t.Error(err)
+	}
+	if err := newApp().Run([]string{"orchestrator", "validate", invalid}); err == nil {
+		t.Error("invalid config is valid")
+	}
+	if err := newApp().Run([]string{"orchestrator", "validate"}); err == nil {
+		t.Error("validate without config has no error")
+	}
+}
+
+func TestRunRejectsInvalidSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "orchestrator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := [][]string{
+		{"orchestrator", "--log-level", "loud"},
+		{"orchestrator", "--config", filepath.Join(dir, "missing.yaml")},
+		{"orchestrator", "--tls-cert", "cert.pem"},
+		{"orchestrator", "--storage", filepath.Join(dir, "missing", "state.jsonl")},
+	}
+	for _, args := range tests {
+		if err := newApp().Run(args); err == nil {
+			t.Errorf("%v: daemon is started", args[1:])
+		}
+	}
+}
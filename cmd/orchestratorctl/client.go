@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mariiatuzovska/orchestrator"
+)
+
+// client calls REST API of orchestrator
+type client struct {
+	server string
+	token  string // bearer token, not sent if empty
+	http   *http.Client
+}
+
+func newClient(ctx *Context, timeout time.Duration) (*client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if ctx.Insecure || ctx.CACert != "" {
+		config := &tls.Config{InsecureSkipVerify: ctx.Insecure}
+		if ctx.CACert != "" {
+			pem, err := ioutil.ReadFile(ctx.CACert)
+			if err != nil {
+				return nil, err
+			}
+			config.RootCAs = x509.NewCertPool()
+			if !config.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("can't parse CA certificate '%s'", ctx.CACert)
+			}
+		}
+		transport.TLSClientConfig = config
+	}
+	return &client{server: strings.TrimRight(ctx.Server, "/"), http: &http.Client{Transport: transport, Timeout: timeout}}, nil
+}
+
+// do sends request with JSON body and returns body of successful response
+func (c *client) do(method, path string, body interface{}) ([]byte, error) {
+	response, err := c.send(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return ioutil.ReadAll(response.Body)
+}
+
+// send sends request, response with error status is returned as error
+func (c *client) send(method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, c.server+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	response, err := c.http.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 300 {
+		defer response.Body.Close()
+		data, _ := ioutil.ReadAll(response.Body)
+		message := orchestrator.JSONMessage{}
+		if json.Unmarshal(data, &message) == nil && message.Message != "" {
+			return nil, fmt.Errorf("%s", message.Message)
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, path, response.Status)
+	}
+	return response, nil
+}
+
+// get decodes JSON response into v and returns raw response for json / yaml output
+func (c *client) get(path string, v interface{}) ([]byte, error) {
+	data, err := c.do(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, fmt.Errorf("can't decode response of %s: %s", path, err.Error())
+	}
+	return data, nil
+}
+
+func (c *client) service(name string) (*orchestrator.Service, []byte, error) {
+	service := new(orchestrator.Service)
+	data, err := c.get("/orchestrator/services/"+name, service)
+	return service, data, err
+}
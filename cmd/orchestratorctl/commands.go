@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mariiatuzovska/orchestrator"
+	"github.com/urfave/cli"
+)
+
+// arg returns the first argument of command
+func arg(c *cli.Context, what string) (string, error) {
+	if c.NArg() < 1 || c.Args().First() == "" {
+		return "", fmt.Errorf("%s is not set, usage: %s %s", what, c.Command.HelpName, c.Command.ArgsUsage)
+	}
+	return c.Args().First(), nil
+}
+
+func connect(c *cli.Context) (*client, error) {
+	ctx, err := currentContext(c)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(ctx, c.GlobalDuration("timeout"))
+}
+
+func host(node *orchestrator.Node) string {
+	if node.Connection == nil {
+		return "local"
+	}
+	return node.Connection.Host
+}
+
+func nodeNames(nodes []*orchestrator.Node) string {
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.NodeName
+	}
+	return strings.Join(names, ",")
+}
+
+var nodesCommand = cli.Command{
+	Name:    "nodes",
+	Aliases: []string{"node"},
+	Usage:   "lists and manages nodes",
+	Subcommands: []cli.Command{
+		{
+			Name:   "list",
+			Usage:  "lists nodes",
+			Action: listNodes,
+		},
+		{
+			Name:         "get",
+			Usage:        "returns node",
+			ArgsUsage:    "NODE",
+			Action:       getNode,
+			BashComplete: completeNodes,
+		},
+		{
+			Name:      "connect",
+			Usage:     "connects orchestrator to node",
+			ArgsUsage: "NODE",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "pass-phrase", Usage: "pass phrase of ssh key", EnvVar: "ORCHESTRATOR_PASS_PHRASE"},
+			},
+			Action: func(c *cli.Context) error {
+				return nodeAction(c, http.MethodPost, &orchestrator.BodyWithPassPhrase{PassPhrase: c.String("pass-phrase")}, "connected")
+			},
+			BashComplete: completeNodes,
+		},
+		{
+			Name:      "disconnect",
+			Usage:     "disconnects orchestrator from node",
+			ArgsUsage: "NODE",
+			Action: func(c *cli.Context) error {
+				return nodeAction(c, http.MethodDelete, nil, "disconnected")
+			},
+			BashComplete: completeNodes,
+		},
+	},
+}
+
+func listNodes(c *cli.Context) error {
+	api, err := connect(c)
+	if err != nil {
+		return err
+	}
+	nodes := []*orchestrator.Node{}
+	data, err := api.get("/orchestrator/nodes", &nodes)
+	if err != nil {
+		return err
+	}
+	return output(c, data, func(t *table) {
+		t.header("NAME", "OS", "STATUS", "HOST")
+		for _, node := range nodes {
+			t.row(node.NodeName, node.OS, node.NodeStatus, host(node))
+		}
+	})
+}
+
+func getNode(c *cli.Context) error {
+	name, err := arg(c, "node name")
+	if err != nil {
+		return err
+	}
+	api, err := connect(c)
+	if err != nil {
+		return err
+	}
+	node := new(orchestrator.Node)
+	data, err := api.get("/orchestrator/nodes/"+url.PathEscape(name), node)
+	if err != nil {
+		return err
+	}
+	return output(c, data, func(t *table) {
+		t.header("NAME", "OS", "STATUS", "HOST", "USER", "SSH KEY")
+		user, key := "", ""
+		if node.Connection != nil {
+			user, key = node.Connection.User, node.Connection.SSHKey
+		}
+		t.row(node.NodeName, node.OS, node.NodeStatus, host(node), user, key)
+	})
+}
+
+func nodeAction(c *cli.Context, method string, body interface{}, done string) error {
+	name, err := arg(c, "node name")
+	if err != nil {
+		return err
+	}
+	api, err := connect(c)
+	if err != nil {
+		return err
+	}
+	if _, err := api.do(method, "/orchestrator/nodes/"+url.PathEscape(name), body); err != nil {
+		return err
+	}
+	fmt.Printf("'%s' node has been %s\n", name, done)
+	return nil
+}
+
+var nodeFlag = cli.StringSliceFlag{Name: "node, n", Usage: "node of service, all nodes of service if not set"}
+
+var servicesCommand = cli.Command{
+	Name:    "services",
+	Aliases: []string{"service", "svc"},
+	Usage:   "lists and manages services",
+	Subcommands: []cli.Command{
+		{
+			Name:   "list",
+			Usage:  "lists services",
+			Action: listServices,
+		},
+		{
+			Name:         "get",
+			Usage:        "returns service",
+			ArgsUsage:    "SERVICE",
+			Action:       getService,
+			BashComplete: completeServices,
+		},
+		{
+			Name:      "start",
+			Usage:     "starts service on nodes",
+			ArgsUsage: "SERVICE",
+			Flags:     []cli.Flag{nodeFlag},
+			Action: func(c *cli.Context) error {
+				return serviceAction(c, "started", http.MethodPost)
+			},
+			BashComplete: completeServices,
+		},
+		{
+			Name:      "stop",
+			Usage:     "stops service on nodes",
+			ArgsUsage: "SERVICE",
+			Flags:     []cli.Flag{nodeFlag},
+			Action: func(c *cli.Context) error {
+				return serviceAction(c, "stopped", http.MethodDelete)
+			},
+			BashComplete: completeServices,
+		},
+		{
+			Name:      "restart",
+			Usage:     "stops and starts service on nodes one by one",
+			ArgsUsage: "SERVICE",
+			Flags:     []cli.Flag{nodeFlag},
+			Action: func(c *cli.Context) error {
+				return serviceAction(c, "restarted", http.MethodDelete, http.MethodPost)
+			},
+			BashComplete: completeServices,
+		},
+		{
+			Name:      "watch",
+			Usage:     "streams events of services, all services if not set",
+			ArgsUsage: "[SERVICE...]",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{Name: "type, t", Usage: "event types, all except status-checked if not set"},
+				cli.BoolFlag{Name: "replay", Usage: "prints recent events first"},
+			},
+			Action:       watchServices,
+			BashComplete: completeServices,
+		},
+	},
+}
+
+func listServices(c *cli.Context) error {
+	api, err := connect(c)
+	if err != nil {
+		return err
+	}
+	services := []*orchestrator.Service{}
+	data, err := api.get("/orchestrator/services", &services)
+	if err != nil {
+		return err
+	}
+	return output(c, data, func(t *table) {
+		t.header("NAME", "STATUS", "HTTP", "NODES", "UPDATED")
+		for _, service := range services {
+			status := service.ServiceStatus
+			t.row(service.ServiceName, status.ServiceStatus, status.HTTPAccessStatus, nodeNames(service.Nodes), status.ThisUpdate)
+		}
+	})
+}
+
+func getService(c *cli.Context) error {
+	name, err := arg(c, "service name")
+	if err != nil {
+		return err
+	}
+	api, err := connect(c)
+	if err != nil {
+		return err
+	}
+	service, data, err := api.service(url.PathEscape(name))
+	if err != nil {
+		return err
+	}
+	return output(c, data, func(t *table) {
+		status := service.ServiceStatus
+		t.header("NAME", "STATUS", "HTTP", "NODES", "URL", "FLAPPING", "UPDATED")
+		t.row(service.ServiceName, status.ServiceStatus, status.HTTPAccessStatus, nodeNames(service.Nodes), service.URL, status.Flapping, status.ThisUpdate)
+	})
+}
+
+// serviceAction calls methods on each node of service one by one
+func serviceAction(c *cli.Context, done string, methods ...string) error {
+	name, err := arg(c, "service name")
+	if err != nil {
+		return err
+	}
+	api, err := connect(c)
+	if err != nil {
+		return err
+	}
+	nodes := c.StringSlice("node")
+	if len(nodes) == 0 {
+		service, _, err := api.service(url.PathEscape(name))
+		if err != nil {
+			return err
+		}
+		for _, node := range service.Nodes {
+			nodes = append(nodes, node.NodeName)
+		}
+	}
+	for _, node := range nodes {
+		path := "/orchestrator/services/" + url.PathEscape(name) + "/" + url.PathEscape(node)
+		for _, method := range methods {
+			if _, err := api.do(method, path, nil); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("'%s' service has been %s on '%s' node\n", name, done, node)
+	}
+	return nil
+}
+
+// watchServices prints server-sent events until interrupted
+func watchServices(c *cli.Context) error {
+	ctx, err := currentContext(c)
+	if err != nil {
+		return err
+	}
+	api, err := newClient(ctx, 0) // stream is not limited by timeout
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	if services := []string(c.Args()); len(services) > 0 {
+		query.Set("service", strings.Join(services, ","))
+	}
+	if types := c.StringSlice("type"); len(types) > 0 {
+		query.Set("type", strings.Join(types, ","))
+	}
+	query.Set("replay", fmt.Sprint(c.Bool("replay")))
+	response, err := api.send(http.MethodGet, "/orchestrator/events?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	format := c.GlobalString("output")
+	t := &table{nil}
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		data := []byte(strings.TrimPrefix(line, "data: "))
+		if format == OutputJSON { // one event per line
+			fmt.Println(string(data))
+			continue
+		}
+		if format == OutputYAML {
+			fmt.Println("---")
+			if err := output(c, data, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		record := new(orchestrator.EventRecord)
+		if err := json.Unmarshal(data, record); err != nil {
+			return err
+		}
+		t.event(record)
+	}
+	return scanner.Err()
+}
+
+func (t *table) event(e *orchestrator.EventRecord) {
+	details := ""
+	switch {
+	case e.From != nil && e.To != nil:
+		details = fmt.Sprintf("%s -> %s", e.From, e.To)
+	case e.Status != nil:
+		details = e.Status.ServiceStatus.String()
+	case e.Alert != nil:
+		details = e.Alert.Message
+	}
+	if e.Error != "" {
+		details = strings.TrimSpace(details + " " + e.Error)
+	}
+	fmt.Fprintf(os.Stdout, "%s  %-20s %-24s %-12s %s\n", e.Time.Local().Format(time.RFC3339), e.Type, e.Service, e.Node, details)
+}
+
+var statusesCommand = cli.Command{
+	Name:         "statuses",
+	Aliases:      []string{"status"},
+	Usage:        "returns statuses of services and their nodes, all services if not set",
+	ArgsUsage:    "[SERVICE...]",
+	Action:       statuses,
+	BashComplete: completeServices,
+}
+
+func statuses(c *cli.Context) error {
+	api, err := connect(c)
+	if err != nil {
+		return err
+	}
+	statuses := []*orchestrator.ServiceStatusInfoResponse{}
+	var data []byte
+	if c.NArg() == 0 {
+		if data, err = api.get("/orchestrator/statuses", &statuses); err != nil {
+			return err
+		}
+	} else {
+		raw := []json.RawMessage{}
+		for _, name := range c.Args() {
+			status := new(orchestrator.ServiceStatusInfoResponse)
+			response, err := api.get("/orchestrator/statuses/"+url.PathEscape(name), status)
+			if err != nil {
+				return err
+			}
+			statuses = append(statuses, status)
+			raw = append(raw, response)
+		}
+		if data, err = json.Marshal(raw); err != nil {
+			return err
+		}
+	}
+	return output(c, data, func(t *table) {
+		t.header("SERVICE", "STATUS", "HTTP", "NODE", "NODE STATUS", "SERVICE ON NODE", "EXIT CODE", "UPDATED")
+		for _, status := range statuses {
+			info := status.StatusInfo
+			if len(info.NodeStatus) == 0 {
+				t.row(status.ServiceName, info.ServiceStatus, info.HTTPAccessStatus, "", "", "", "", info.ThisUpdate)
+			}
+			for _, node := range info.NodeStatus {
+				t.row(status.ServiceName, info.ServiceStatus, info.HTTPAccessStatus, node.NodeName, node.NodeStatus, node.ServiceStatus, node.ExitCode, info.ThisUpdate)
+			}
+		}
+	})
+}
+
+var execCommand = cli.Command{
+	Name:      "exec",
+	Usage:     "runs command on node, exec must be enabled by --exec-token of orchestrator",
+	ArgsUsage: "NODE -- COMMAND [ARGS...]",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "token", Usage: "exec token of orchestrator", EnvVar: "ORCHESTRATOR_EXEC_TOKEN"},
+	},
+	Action:       execute,
+	BashComplete: completeNodes,
+}
+
+func execute(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return fmt.Errorf("node and command are not set, usage: %s %s", c.Command.HelpName, c.Command.ArgsUsage)
+	}
+	args := []string(c.Args())
+	node, command := args[0], args[1:]
+	if command[0] == "--" {
+		command = command[1:]
+	}
+	api, err := connect(c)
+	if err != nil {
+		return err
+	}
+	api.token = c.String("token")
+	result := new(orchestrator.CommandOutput)
+	data, err := api.do(http.MethodPost, "/orchestrator/nodes/"+url.PathEscape(node)+"/exec", &orchestrator.BodyWithCommand{Command: shellJoin(command)})
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return err
+	}
+	if format := c.GlobalString("output"); format != OutputTable && format != "" {
+		return output(c, data, nil)
+	}
+	fmt.Print(result.Output)
+	return nil
+}
+
+// shellJoin joins arguments into command line, a single argument is a command line itself,
+// several ones are quoted for shell
+func shellJoin(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'`$\\|&;<>()*?[]{}~#!") {
+			quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+var logsCommand = cli.Command{
+	Name:      "logs",
+	Usage:     "prints last lines of service logs on node",
+	ArgsUsage: "SERVICE",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "node, n", Usage: "node of service, required if service has several nodes"},
+		cli.IntFlag{Name: "lines", Usage: "number of lines", Value: orchestrator.DefaultLogLines},
+	},
+	Action:       logs,
+	BashComplete: completeServices,
+}
+
+func logs(c *cli.Context) error {
+	name, err := arg(c, "service name")
+	if err != nil {
+		return err
+	}
+	api, err := connect(c)
+	if err != nil {
+		return err
+	}
+	node := c.String("node")
+	if node == "" {
+		service, _, err := api.service(url.PathEscape(name))
+		if err != nil {
+			return err
+		}
+		if len(service.Nodes) != 1 {
+			return fmt.Errorf("'%s' service has nodes %s, set one by --node", name, nodeNames(service.Nodes))
+		}
+		node = service.Nodes[0].NodeName
+	}
+	path := fmt.Sprintf("/orchestrator/services/%s/%s/logs?lines=%d", url.PathEscape(name), url.PathEscape(node), c.Int("lines"))
+	data, err := api.do(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(data))
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mariiatuzovska/orchestrator"
+)
+
+// run runs orchestratorctl with args and returns its standard output
+func run(t *testing.T, args ...string) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out := make(chan string)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		out <- string(data)
+	}()
+	err = newApp().Run(append([]string{"orchestratorctl"}, args...))
+	os.Stdout = stdout
+	w.Close()
+	return <-out, err
+}
+
+// startServer returns REST API of orchestrator with local node and 'web' service on it
+func startServer(t *testing.T) (*httptest.Server, func()) {
+	o := orchestrator.NewOrchestrator()
+	node := orchestrator.NewNode(&orchestrator.NodeInfo{NodeName: "local", OS: orchestrator.OSLinux})
+	if err := o.RegistrateNodes(node); err != nil {
+		t.Fatal(err)
+	}
+	info := &orchestrator.ServiceInfo{ServiceName: "web", Schedule: orchestrator.Schedule{Interval: -1}}
+	if err := o.RegistrateServices(orchestrator.NewService(info, node)); err != nil {
+		t.Fatal(err)
+	}
+	api := o.Server()
+	api.ExecToken = "secret"
+	server := httptest.NewServer(api)
+	return server, func() {
+		server.Close()
+		o.Stop()
+	}
+}
+
+func TestShellJoin(t *testing.T) {
+	tests := []struct {
+		args    []string
+		command string
+	}{
+		{[]string{"uptime -p"}, "uptime -p"},
+		{[]string{"echo", "a b"}, "echo 'a b'"},
+		{[]string{"echo", "it's"}, `echo 'it'\''s'`},
+		{[]string{"echo", "$HOME", ""}, "echo '$HOME' ''"},
+		{[]string{"ls", "-la", "/tmp"}, "ls -la /tmp"},
+	}
+	for _, test := range tests {
+		if command := shellJoin(test.args); command != test.command {
+			t.Errorf("%q is joined into %q, expected %q", test.args, command, test.command)
+		}
+	}
+}
+
+func TestNodesAndServices(t *testing.T) {
+	server, stop := startServer(t)
+	defer stop()
+
+	out, err := run(t, "--server", server.URL, "nodes", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 ||
+		strings.Join(strings.Fields(lines[0]), " ") != "NAME OS STATUS HOST" || !strings.HasPrefix(lines[1], "local") {
+		t.Errorf("unexpected table of nodes:\n%s", out)
+	}
+
+	out, err = run(t, "--server", server.URL, "--output", "json", "nodes", "get", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := new(orchestrator.Node)
+	if err := json.Unmarshal([]byte(out), node); err != nil || node.NodeName != "local" {
+		t.Errorf("unexpected json of node (%v):\n%s", err, out)
+	}
+
+	out, err = run(t, "--server", server.URL, "--output", "yaml", "services", "get", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "\nServiceName: web\n") || strings.Contains(out, "{") {
+		t.Errorf("unexpected yaml of service:\n%s", out)
+	}
+
+	if _, err := run(t, "--server", server.URL, "nodes", "get", "missing"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("error of unknown node is %v, expected message of server", err)
+	}
+	if _, err := run(t, "--server", server.URL, "--output", "xml", "nodes", "list"); err == nil {
+		t.Error("unknown output format has no error")
+	}
+	if _, err := run(t, "--server", server.URL, "nodes", "get"); err == nil {
+		t.Error("node name is not required")
+	}
+}
+
+func TestExec(t *testing.T) {
+	server, stop := startServer(t)
+	defer stop()
+
+	out, err := run(t, "--server", server.URL, "exec", "--token", "secret", "local", "--", "echo", "a  b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "a  b\n" {
+		t.Errorf("output is %q, expected %q", out, "a  b\n")
+	}
+	if _, err := run(t, "--server", server.URL, "exec", "--token", "wrong", "local", "--", "true"); err == nil ||
+		!strings.Contains(err.Error(), "Invalid exec token") {
+		t.Errorf("error of wrong token is %v", err)
+	}
+}
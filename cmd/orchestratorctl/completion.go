@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mariiatuzovska/orchestrator"
+	"github.com/urfave/cli"
+)
+
+const bashCompletion = `_orchestratorctl_complete() {
+  local cur opts
+  COMPREPLY=()
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  if [[ "$cur" == "-"* ]]; then
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} ${cur} --generate-bash-completion 2>/dev/null )
+  else
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} --generate-bash-completion 2>/dev/null )
+  fi
+  COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+  return 0
+}
+complete -o bashdefault -o default -F _orchestratorctl_complete orchestratorctl
+`
+
+const zshCompletion = `autoload -U compinit && compinit
+autoload -U bashcompinit && bashcompinit
+` + bashCompletion
+
+var completionCommand = cli.Command{
+	Name:      "completion",
+	Usage:     "prints shell completion script, e.g. source <(orchestratorctl completion bash)",
+	ArgsUsage: "bash|zsh",
+	Action: func(c *cli.Context) error {
+		switch c.Args().First() {
+		case "bash":
+			fmt.Print(bashCompletion)
+		case "zsh":
+			fmt.Print(zshCompletion)
+		default:
+			return fmt.Errorf("unknown shell, usage: %s %s", c.Command.HelpName, c.Command.ArgsUsage)
+		}
+		return nil
+	},
+	BashComplete: func(c *cli.Context) {
+		fmt.Println("bash\nzsh")
+	},
+}
+
+// completeNodes prints names of nodes, errors are ignored
+func completeNodes(c *cli.Context) {
+	if c.NArg() > 0 {
+		return
+	}
+	api, err := connect(c)
+	if err != nil {
+		return
+	}
+	nodes := []*orchestrator.Node{}
+	if _, err := api.get("/orchestrator/nodes", &nodes); err != nil {
+		return
+	}
+	for _, node := range nodes {
+		fmt.Println(node.NodeName)
+	}
+}
+
+// completeServices prints names of services, errors are ignored
+func completeServices(c *cli.Context) {
+	api, err := connect(c)
+	if err != nil {
+		return
+	}
+	services := []*orchestrator.Service{}
+	if _, err := api.get("/orchestrator/services", &services); err != nil {
+		return
+	}
+	for _, service := range services {
+		fmt.Println(service.ServiceName)
+	}
+}
+
+func completeContexts(c *cli.Context) {
+	ctxs, err := loadContexts(c)
+	if err != nil {
+		return
+	}
+	for _, ctx := range ctxs.Contexts {
+		fmt.Println(ctx.Name)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultServer is used if there is no context
+const DefaultServer = "http://127.0.0.1:8080"
+
+// Context is an orchestrator endpoint
+type Context struct {
+	Name     string `yaml:"name"`
+	Server   string `yaml:"server"`             // http(s)://host:port
+	Insecure bool   `yaml:"insecure,omitempty"` // TLS certificate is not verified
+	CACert   string `yaml:"ca-cert,omitempty"`  // path to CA certificate of server
+}
+
+// contexts is a file with orchestrator endpoints, ~/.orchestratorctl.yaml by default
+type contexts struct {
+	CurrentContext string     `yaml:"current-context"`
+	Contexts       []*Context `yaml:"contexts"`
+
+	path string
+}
+
+func contextsPath(c *cli.Context) string {
+	if path := c.GlobalString("contexts"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".orchestratorctl.yaml"
+	}
+	return filepath.Join(home, ".orchestratorctl.yaml")
+}
+
+func loadContexts(c *cli.Context) (*contexts, error) {
+	ctxs := &contexts{Contexts: []*Context{}, path: contextsPath(c)}
+	data, err := ioutil.ReadFile(ctxs.path)
+	if os.IsNotExist(err) {
+		return ctxs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, ctxs); err != nil {
+		return nil, fmt.Errorf("%s: %s", ctxs.path, err.Error())
+	}
+	return ctxs, nil
+}
+
+func (ctxs *contexts) save() error {
+	data, err := yaml.Marshal(ctxs)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ctxs.path, data, 0600)
+}
+
+func (ctxs *contexts) get(name string) (*Context, int) {
+	for i, ctx := range ctxs.Contexts {
+		if ctx.Name == name {
+			return ctx, i
+		}
+	}
+	return nil, -1
+}
+
+// currentContext returns endpoint by --server, --context, current context or DefaultServer
+func currentContext(c *cli.Context) (*Context, error) {
+	if server := c.GlobalString("server"); server != "" {
+		return &Context{Name: "", Server: server, Insecure: c.GlobalBool("insecure")}, nil
+	}
+	ctxs, err := loadContexts(c)
+	if err != nil {
+		return nil, err
+	}
+	name := c.GlobalString("context")
+	if name == "" {
+		name = ctxs.CurrentContext
+	}
+	if name == "" {
+		return &Context{Server: DefaultServer, Insecure: c.GlobalBool("insecure")}, nil
+	}
+	ctx, _ := ctxs.get(name)
+	if ctx == nil {
+		return nil, fmt.Errorf("'%s' context is not defined in %s", name, ctxs.path)
+	}
+	if c.GlobalBool("insecure") {
+		ctx.Insecure = true
+	}
+	return ctx, nil
+}
+
+var contextCommand = cli.Command{
+	Name:  "context",
+	Usage: "manages orchestrator endpoints",
+	Subcommands: []cli.Command{
+		{
+			Name:  "list",
+			Usage: "lists contexts",
+			Action: func(c *cli.Context) error {
+				ctxs, err := loadContexts(c)
+				if err != nil {
+					return err
+				}
+				return output(c, ctxs.Contexts, func(t *table) {
+					t.header("CURRENT", "NAME", "SERVER", "INSECURE")
+					for _, ctx := range ctxs.Contexts {
+						current := ""
+						if ctx.Name == ctxs.CurrentContext {
+							current = "*"
+						}
+						t.row(current, ctx.Name, ctx.Server, ctx.Insecure)
+					}
+				})
+			},
+		},
+		{
+			Name:  "current",
+			Usage: "prints current context",
+			Action: func(c *cli.Context) error {
+				ctxs, err := loadContexts(c)
+				if err != nil {
+					return err
+				}
+				if ctxs.CurrentContext == "" {
+					return fmt.Errorf("current context is not set, %s is used", DefaultServer)
+				}
+				fmt.Println(ctxs.CurrentContext)
+				return nil
+			},
+		},
+		{
+			Name:      "use",
+			Usage:     "sets current context",
+			ArgsUsage: "NAME",
+			Action: func(c *cli.Context) error {
+				name, err := arg(c, "context name")
+				if err != nil {
+					return err
+				}
+				ctxs, err := loadContexts(c)
+				if err != nil {
+					return err
+				}
+				if ctx, _ := ctxs.get(name); ctx == nil {
+					return fmt.Errorf("'%s' context is not defined", name)
+				}
+				ctxs.CurrentContext = name
+				return ctxs.save()
+			},
+			BashComplete: completeContexts,
+		},
+		{
+			Name:      "set",
+			Usage:     "adds or updates context, the first context becomes current",
+			ArgsUsage: "NAME",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "server", Usage: "http(s)://host:port of orchestrator"},
+				cli.BoolFlag{Name: "insecure", Usage: "does not verify TLS certificate of server"},
+				cli.StringFlag{Name: "ca-cert", Usage: "CA certificate of server"},
+			},
+			Action: func(c *cli.Context) error {
+				name, err := arg(c, "context name")
+				if err != nil {
+					return err
+				}
+				ctxs, err := loadContexts(c)
+				if err != nil {
+					return err
+				}
+				ctx, _ := ctxs.get(name)
+				if ctx == nil {
+					if c.String("server") == "" {
+						return fmt.Errorf("server of new context is not set")
+					}
+					ctx = &Context{Name: name}
+					ctxs.Contexts = append(ctxs.Contexts, ctx)
+				}
+				if c.IsSet("server") {
+					ctx.Server = c.String("server")
+				}
+				if c.IsSet("insecure") {
+					ctx.Insecure = c.Bool("insecure")
+				}
+				if c.IsSet("ca-cert") {
+					if ctx.CACert, err = filepath.Abs(c.String("ca-cert")); err != nil {
+						return err
+					}
+				}
+				if ctxs.CurrentContext == "" {
+					ctxs.CurrentContext = name
+				}
+				return ctxs.save()
+			},
+			BashComplete: completeContexts,
+		},
+		{
+			Name:      "delete",
+			Usage:     "deletes context",
+			ArgsUsage: "NAME",
+			Action: func(c *cli.Context) error {
+				name, err := arg(c, "context name")
+				if err != nil {
+					return err
+				}
+				ctxs, err := loadContexts(c)
+				if err != nil {
+					return err
+				}
+				_, i := ctxs.get(name)
+				if i < 0 {
+					return fmt.Errorf("'%s' context is not defined", name)
+				}
+				ctxs.Contexts = append(ctxs.Contexts[:i], ctxs.Contexts[i+1:]...)
+				if ctxs.CurrentContext == name {
+					ctxs.CurrentContext = ""
+				}
+				return ctxs.save()
+			},
+			BashComplete: completeContexts,
+		},
+	},
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContexts(t *testing.T) {
+	server, stop := startServer(t)
+	defer stop()
+	dir, err := ioutil.TempDir("", "orchestratorctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	contexts := "--contexts=" + filepath.Join(dir, "contexts.yaml")
+
+	if _, err := run(t, contexts, "context", "current"); err == nil {
+		t.Error("current context is set without contexts")
+	}
+	if _, err := run(t, contexts, "context", "set", "prod"); err == nil {
+		t.Error("context without server is added")
+	}
+	if _, err := run(t, contexts, "context", "set", "prod", "--server", server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(t, contexts, "context", "set", "stage", "--server", "http://127.0.0.1:1", "--insecure"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := run(t, contexts, "context", "current")
+	if err != nil || out != "prod\n" {
+		t.Errorf("current context is %q (%v), expected the first one", out, err)
+	}
+	if out, err = run(t, contexts, "nodes", "list"); err != nil || !strings.Contains(out, "local") {
+		t.Errorf("nodes of current context: %v\n%s", err, out)
+	}
+	if _, err := run(t, contexts, "--context", "stage", "nodes", "list"); err == nil {
+		t.Error("nodes are listed by unreachable context")
+	}
+
+	if _, err := run(t, contexts, "context", "use", "stage"); err != nil {
+		t.Fatal(err)
+	}
+	out, err = run(t, contexts, "context", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n")[1:] {
+		if fields := strings.Fields(line); (fields[0] == "*") != strings.Contains(line, "stage") {
+			t.Errorf("'stage' context is not marked as current:\n%s", out)
+		}
+	}
+	if _, err := run(t, contexts, "context", "delete", "stage"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(t, contexts, "context", "current"); err == nil {
+		t.Error("deleted context is current")
+	}
+	if _, err := run(t, contexts, "context", "use", "stage"); err == nil {
+		t.Error("deleted context is used")
+	}
+	if _, err := run(t, contexts, "--context", "missing", "nodes", "list"); err == nil {
+		t.Error("unknown context is used")
+	}
+}
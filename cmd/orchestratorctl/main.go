@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mariiatuzovska/orchestrator"
+	"github.com/urfave/cli"
+)
+
+func main() {
+	if err := newApp().Run(os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+// newApp returns client application with its flags and commands
+func newApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = "orchestratorctl"
+	app.Usage = "command-line client of orchestrator REST API"
+	app.Version = orchestrator.Version
+	app.EnableBashCompletion = true
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "context",
+			Usage:  "context of orchestrator endpoint, current context if not set",
+			EnvVar: "ORCHESTRATOR_CONTEXT",
+		},
+		cli.StringFlag{
+			Name:   "server, s",
+			Usage:  "http(s)://host:port of orchestrator, overrides context",
+			EnvVar: "ORCHESTRATOR_SERVER",
+		},
+		cli.BoolFlag{
+			Name:  "insecure",
+			Usage: "does not verify TLS certificate of server",
+		},
+		cli.StringFlag{
+			Name:   "contexts",
+			Usage:  "file of contexts (default: ~/.orchestratorctl.yaml)",
+			EnvVar: "ORCHESTRATORCTL_CONTEXTS",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "output format: table / json / yaml",
+			Value: OutputTable,
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "timeout of request",
+			Value: 30 * time.Second,
+		},
+	}
+	app.Commands = []cli.Command{
+		nodesCommand,
+		servicesCommand,
+		statusesCommand,
+		execCommand,
+		logsCommand,
+		contextCommand,
+		completionCommand,
+	}
+	return app
+}
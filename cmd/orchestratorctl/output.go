@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+// OUTPUT FORMATS
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+type table struct {
+	w *tabwriter.Writer
+}
+
+func (t *table) header(columns ...string) {
+	fmt.Fprintln(t.w, strings.Join(columns, "\t"))
+}
+
+func (t *table) row(values ...interface{}) {
+	cells := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case time.Time:
+			cells[i] = age(v)
+		case string:
+			cells[i] = v
+			if v == "" {
+				cells[i] = "-"
+			}
+		default:
+			cells[i] = fmt.Sprint(v)
+		}
+	}
+	fmt.Fprintln(t.w, strings.Join(cells, "\t"))
+}
+
+// age returns time passed since t like 5s, 3m, 2h or 4d
+func age(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	d := time.Since(t)
+	suffix := ""
+	if d < 0 {
+		d, suffix = -d, " later"
+	}
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds%s", int(d.Seconds()), suffix)
+	case d < time.Hour:
+		return fmt.Sprintf("%dm%s", int(d.Minutes()), suffix)
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh%s", int(d.Hours()), suffix)
+	}
+	return fmt.Sprintf("%dd%s", int(d.Hours()/24), suffix)
+}
+
+// output prints v by --output format, raw JSON response ([]byte) is printed as is,
+// table is filled by fill
+func output(c *cli.Context, v interface{}, fill func(t *table)) error {
+	format := c.GlobalString("output")
+	if format == OutputTable || format == "" {
+		t := &table{tabwriter.NewWriter(os.Stdout, 0, 4, 3, ' ', 0)}
+		fill(t)
+		return t.w.Flush()
+	}
+	data, ok := v.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	switch format {
+	case OutputJSON:
+		buf := new(bytes.Buffer)
+		if err := json.Indent(buf, data, "", "  "); err != nil {
+			return err
+		}
+		fmt.Println(buf.String())
+	case OutputYAML:
+		node := new(yaml.Node) // json is yaml, keys keep their order
+		if err := yaml.Unmarshal(data, node); err != nil {
+			return err
+		}
+		block(node)
+		out, err := yaml.Marshal(node)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+	default:
+		return fmt.Errorf("unknown '%s' output format, use %s / %s / %s", format, OutputTable, OutputJSON, OutputYAML)
+	}
+	return nil
+}
+
+// block converts flow style of json into block style of yaml
+func block(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle
+	if node.Kind == yaml.ScalarNode && node.Style&yaml.DoubleQuotedStyle != 0 && node.Tag == "!!str" {
+		node.Style &^= yaml.DoubleQuotedStyle
+	}
+	for _, child := range node.Content {
+		block(child)
+	}
+}
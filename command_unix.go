@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package orchestrator
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes command a leader of new process group
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills started command with its child processes
+func killProcessGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,10 @@
+package orchestrator
+
+import "os/exec"
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills started command, its child processes are not tracked
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,545 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// CONFIG FORMATS
+const (
+	ConfigYAML = "yaml"
+	ConfigJSON = "json"
+	ConfigTOML = "toml"
+)
+
+// DefaultServerAddress is a listen address of server if it is not configured
+const DefaultServerAddress = "127.0.0.1:8080"
+
+// Config is declarative configuration of orchestrator, keys are matched case-insensitively
+// like in JSON API, string values may refer environment variables as ${NAME} or ${NAME:-default}
+type Config struct {
+	Server       ServerConfig
+	LogLevel     string // debug / info / warning / error
+	HistoryLimit int    // DefaultHistoryLimit if 0
+	ProbeWorkers int    // DefaultProbeWorkers if 0
+	NodeProbes   int    // DefaultNodeProbes if 0
+	Storage      string // path of file storage, nothing is persisted if empty, is not changed by reload
+	Nodes        []*NodeInfo
+	Services     []*ServiceConfig
+
+	file     string
+	lines    map[string]int // line of item by lowercased path like "services[1]"
+	nodes    []*Node        // built and validated nodes
+	services []*Service     // built and validated services
+}
+
+type ServerConfig struct {
+	Address string // DefaultServerAddress if empty
+	TLSCert string // path to certificate, server uses TLS if both certificate and key are set
+	TLSKey  string // path to private key
+}
+
+// ServiceConfig is a service with names of its nodes
+type ServiceConfig struct {
+	ServiceInfo
+	Nodes []string
+}
+
+// ParseConfig reads and validates configuration file, format is defined by extension:
+// .yaml / .yml / .json / .toml
+func ParseConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Config: %s", err.Error())
+	}
+	format := ""
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = ConfigYAML
+	case ".json":
+		format = ConfigJSON
+	case ".toml":
+		format = ConfigTOML
+	default:
+		return nil, fmt.Errorf("Config: unknown format of '%s' file", path)
+	}
+	return readConfig(data, format, path)
+}
+
+// ReadConfig parses and validates configuration in yaml, json or toml format
+func ReadConfig(data []byte, format string) (*Config, error) {
+	return readConfig(data, format, "config")
+}
+
+func readConfig(data []byte, format, file string) (*Config, error) {
+	c := &Config{file: file, lines: make(map[string]int)}
+	var tree interface{}
+	var err error
+	switch format {
+	case ConfigYAML, ConfigJSON: // json is parsed as yaml to keep line numbers
+		root := new(yaml.Node)
+		if err := yaml.Unmarshal(data, root); err != nil {
+			return nil, fmt.Errorf("Config: %s: %s", file, err.Error())
+		}
+		if len(root.Content) > 0 {
+			tree, err = c.yamlValue(root.Content[0], "")
+		}
+	case ConfigTOML:
+		doc := make(map[string]interface{})
+		if _, err := toml.Decode(string(data), &doc); err != nil {
+			return nil, fmt.Errorf("Config: %s: %s", file, err.Error())
+		}
+		c.tomlLines(data)
+		tree, err = c.expandValue(doc, "")
+	default:
+		return nil, fmt.Errorf("Config: unknown '%s' format", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := c.decode(tree); err != nil {
+		return nil, err
+	}
+	if c.nodes, c.services, err = c.build(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// decode fills config by parsed tree, items are decoded one by one to report their lines
+func (c *Config) decode(tree interface{}) error {
+	if tree == nil {
+		return nil
+	}
+	data, err := json.Marshal(fit(tree, reflect.TypeOf(c)))
+	if err != nil {
+		return c.errorf("", "%s", err.Error())
+	}
+	doc := struct {
+		Server       ServerConfig
+		LogLevel     string
+		HistoryLimit int
+		ProbeWorkers int
+		NodeProbes   int
+		Storage      string
+		Nodes        []json.RawMessage
+		Services     []json.RawMessage
+	}{}
+	if err := strictUnmarshal(data, &doc); err != nil {
+		return c.errorf("", "%s", err.Error())
+	}
+	c.Server, c.LogLevel, c.HistoryLimit = doc.Server, doc.LogLevel, doc.HistoryLimit
+	c.ProbeWorkers, c.NodeProbes, c.Storage = doc.ProbeWorkers, doc.NodeProbes, doc.Storage
+	for i, raw := range doc.Nodes {
+		node := new(NodeInfo)
+		if err := strictUnmarshal(raw, node); err != nil {
+			return c.errorf(fmt.Sprintf("nodes[%d]", i), "%s", err.Error())
+		}
+		c.Nodes = append(c.Nodes, node)
+	}
+	for i, raw := range doc.Services {
+		service := new(ServiceConfig)
+		if err := strictUnmarshal(raw, service); err != nil {
+			return c.errorf(fmt.Sprintf("services[%d]", i), "%s", err.Error())
+		}
+		c.Services = append(c.Services, service)
+	}
+	return nil
+}
+
+func strictUnmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// build validates config and returns its nodes and services
+func (c *Config) build() ([]*Node, []*Service, error) {
+	if _, err := ParseLogLevel(c.LogLevel); err != nil {
+		return nil, nil, c.errorf("", "%s", err.Error())
+	}
+	if c.HistoryLimit < 0 || c.ProbeWorkers < 0 || c.NodeProbes < 0 {
+		return nil, nil, c.errorf("", "history limit and probe limits must not be negative")
+	}
+	if (c.Server.TLSCert == "") != (c.Server.TLSKey == "") {
+		return nil, nil, c.errorf("server", "both TLS certificate and key must be set")
+	}
+	nodes := []*Node{}
+	byName := make(map[string]*Node)
+	for i, info := range c.Nodes {
+		node := NewNode(info).copy()
+		if err := node.Valid(); err != nil {
+			return nil, nil, c.errorf(fmt.Sprintf("nodes[%d]", i), "%s", err.Error())
+		}
+		if _, exist := byName[node.NodeName]; exist {
+			return nil, nil, c.errorf(fmt.Sprintf("nodes[%d]", i), "'%s' node is defined twice", node.NodeName)
+		}
+		for _, n := range nodes {
+			if n.Connection == nil && node.Connection == nil {
+				return nil, nil, c.errorf(fmt.Sprintf("nodes[%d]", i), "'%s' local node is already defined", n.NodeName)
+			}
+			if n.Connection != nil && node.Connection != nil && n.Connection.Host == node.Connection.Host {
+				return nil, nil, c.errorf(fmt.Sprintf("nodes[%d]", i), "'%s' node is already defined with same '%s' host", n.NodeName, node.Connection.Host)
+			}
+		}
+		byName[node.NodeName] = node
+		nodes = append(nodes, node)
+	}
+	services := []*Service{}
+	defined := make(map[string]bool)
+	for i, config := range c.Services {
+		path := fmt.Sprintf("services[%d]", i)
+		service := NewService(&config.ServiceInfo)
+		service.ServiceInfo = config.ServiceInfo.copy()
+		for _, name := range config.Nodes {
+			node, exist := byName[name]
+			if !exist {
+				return nil, nil, c.errorf(path, "'%s' node is not defined", name)
+			}
+			if err := service.SetNode(node); err != nil {
+				return nil, nil, c.errorf(path, "%s", err.Error())
+			}
+		}
+		for j, access := range service.HTTPAccess {
+			if err := access.Valid(); err != nil {
+				return nil, nil, c.errorf(fmt.Sprintf("%s.httpaccess[%d]", path, j), "%s", err.Error())
+			}
+		}
+		if err := service.Valid(); err != nil {
+			return nil, nil, c.errorf(path, "%s", err.Error())
+		}
+		if defined[service.ServiceName] {
+			return nil, nil, c.errorf(path, "'%s' service is defined twice", service.ServiceName)
+		}
+		defined[service.ServiceName] = true
+		services = append(services, service)
+	}
+	return nodes, services, nil
+}
+
+// errorf returns error with file and line of item by path
+func (c *Config) errorf(path, format string, msg ...interface{}) error {
+	if line, exist := c.lines[path]; exist {
+		return fmt.Errorf("Config: %s:%d: %s", c.file, line, fmt.Sprintf(format, msg...))
+	}
+	if path != "" {
+		return fmt.Errorf("Config: %s: %s: %s", c.file, path, fmt.Sprintf(format, msg...))
+	}
+	return fmt.Errorf("Config: %s: %s", c.file, fmt.Sprintf(format, msg...))
+}
+
+// yamlValue converts yaml node into plain value with expanded environment variables
+// and keeps lines of items
+func (c *Config) yamlValue(node *yaml.Node, path string) (interface{}, error) {
+	if path != "" {
+		c.lines[path] = node.Line
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return c.yamlValue(node.Content[0], path)
+	case yaml.AliasNode:
+		return c.yamlValue(node.Alias, path)
+	case yaml.MappingNode:
+		value := make(map[string]interface{})
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			item, err := c.yamlValue(node.Content[i+1], join(path, key))
+			if err != nil {
+				return nil, err
+			}
+			value[key] = item
+		}
+		return value, nil
+	case yaml.SequenceNode:
+		value := make([]interface{}, len(node.Content))
+		for i, item := range node.Content {
+			v, err := c.yamlValue(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			value[i] = v
+		}
+		return value, nil
+	}
+	if node.Tag != "!!str" {
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return nil, fmt.Errorf("Config: %s:%d: %s", c.file, node.Line, err.Error())
+		}
+		return value, nil
+	}
+	expanded, err := expandEnv(node.Value)
+	if err != nil {
+		return nil, fmt.Errorf("Config: %s:%d: %s", c.file, node.Line, err.Error())
+	}
+	return expanded, nil
+}
+
+var jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// fit converts scalars to types of fields, e.g. port: 22 into string or timeoutSeconds: ${TIMEOUT} into int
+func fit(value interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshaler) {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Struct:
+			for key, item := range v {
+				if field, exist := fieldByName(t, key); exist {
+					v[key] = fit(item, field.Type)
+				}
+			}
+		case reflect.Map:
+			for key, item := range v {
+				v[key] = fit(item, t.Elem())
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice {
+			for i, item := range v {
+				v[i] = fit(item, t.Elem())
+			}
+		}
+	case string:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n
+			}
+		case reflect.Float32, reflect.Float64:
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				return n
+			}
+		case reflect.Bool:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b
+			}
+		}
+	case int, int64, uint64, float64, bool:
+		if t.Kind() == reflect.String {
+			return fmt.Sprint(v)
+		}
+	}
+	return value
+}
+
+// fieldByName finds field case-insensitively like encoding/json, including promoted fields
+func fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.Anonymous && field.PkgPath == "" && strings.EqualFold(field.Name, name) {
+			return field, true
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if f, exist := fieldByName(field.Type, name); exist {
+				return f, true
+			}
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// expandValue expands environment variables in strings of toml document
+func (c *Config) expandValue(value interface{}, path string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		expanded, err := expandEnv(v)
+		if err != nil {
+			return nil, c.errorf(path, "%s", err.Error())
+		}
+		return expanded, nil
+	case map[string]interface{}:
+		for key, item := range v {
+			expanded, err := c.expandValue(item, join(path, key))
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			expanded, err := c.expandValue(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = expanded
+		}
+		return items, nil
+	case []interface{}:
+		for i, item := range v {
+			expanded, err := c.expandValue(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	}
+	return value, nil
+}
+
+var tomlArrayTable = regexp.MustCompile(`^\s*\[\[\s*([A-Za-z0-9_.-]+)\s*\]\]`)
+
+// tomlLines keeps lines of top-level array tables like [[services]]
+func (c *Config) tomlLines(data []byte) {
+	count := make(map[string]int)
+	for i, line := range strings.Split(string(data), "\n") {
+		match := tomlArrayTable.FindStringSubmatch(line)
+		if match == nil || strings.Contains(match[1], ".") {
+			continue
+		}
+		key := strings.ToLower(match[1])
+		c.lines[fmt.Sprintf("%s[%d]", key, count[key])] = i + 1
+		count[key]++
+	}
+}
+
+func join(path, key string) string {
+	key = strings.ToLower(key)
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+var envVariable = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces ${NAME} and ${NAME:-default} by environment variables, $$ is replaced by $
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envVariable.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+		sub := envVariable.FindStringSubmatch(match)
+		if value, exist := os.LookupEnv(sub[1]); exist {
+			return value
+		}
+		if sub[2] != "" {
+			return sub[3]
+		}
+		if err == nil {
+			err = fmt.Errorf("environment variable '%s' is not set", sub[1])
+		}
+		return ""
+	})
+	return expanded, err
+}
+
+// ParseLogLevel returns log level by name: debug / info / warning / error / fatal, INFO if empty
+func ParseLogLevel(level string) (int, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return DEBUG, nil
+	case "", "info":
+		return INFO, nil
+	case "warning", "warn":
+		return WARNING, nil
+	case "error":
+		return ERROR, nil
+	case "fatal":
+		return FATAL, nil
+	}
+	return INFO, fmt.Errorf("unknown '%s' log level", level)
+}
+
+// LoadConfig reads configuration file and registers its nodes and services in one call,
+// nothing is registered if configuration is not valid or conflicts with registered nodes and services
+func (o *Orchestrator) LoadConfig(path string) (*Config, error) {
+	config, err := ParseConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	nodes, services := config.nodes, config.services
+	o.mu.Lock()
+	for i, node := range nodes {
+		if _, exist := o.node[node.NodeName]; exist {
+			o.mu.Unlock()
+			return nil, config.errorf(fmt.Sprintf("nodes[%d]", i), "'%s' node already exist", node.NodeName)
+		}
+	}
+	for i, service := range services {
+		if _, exist := o.service[service.ServiceName]; exist {
+			o.mu.Unlock()
+			return nil, config.errorf(fmt.Sprintf("services[%d]", i), "'%s' service already exist", service.ServiceName)
+		}
+	}
+	added := []*Node{}
+	for _, node := range nodes {
+		if err = o.addNode(node); err != nil {
+			break
+		}
+		added = append(added, node)
+	}
+	saved := []*Service{}
+	if err == nil {
+		saved, err = o.addServices(services...)
+	}
+	if err != nil { // added nodes are not persisted and not used by any service yet
+		for _, node := range added {
+			delete(o.node, node.NodeName)
+		}
+		o.mu.Unlock()
+		return nil, err
+	}
+	started := o.started
+	o.mu.Unlock()
+	for _, node := range nodes {
+		cp := node.copy()
+		o.persist(func(s Storage) error { return s.SaveNode(cp) })
+	}
+	for _, service := range saved {
+		o.persist(func(s Storage) error { return s.SaveService(service) })
+		if started {
+			go o.ServiceStatusRoutine(service.ServiceName)
+		}
+	}
+	o.configure(config)
+	o.mu.Lock()
+	o.configPath = path
+	o.mu.Unlock()
+	o.logf(INFO, "'%s' config has been loaded: %d nodes, %d services", path, len(nodes), len(services))
+	return config, nil
+}
+
+// configure applies orchestrator settings of config
+func (o *Orchestrator) configure(config *Config) {
+	o.mu.RLock()
+	pinned := o.logPinned
+	o.mu.RUnlock()
+	if !pinned {
+		level, _ := ParseLogLevel(config.LogLevel)
+		o.SetLogLevel(level)
+	}
+	o.SetHistoryLimit(config.HistoryLimit)
+	workers, perNode := config.ProbeWorkers, config.NodeProbes
+	if workers == 0 {
+		workers = DefaultProbeWorkers
+	}
+	if perNode == 0 {
+		perNode = DefaultNodeProbes
+	}
+	o.SetProbeLimits(workers, perNode)
+}
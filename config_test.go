@@ -0,0 +1,226 @@
+package orchestrator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, dir, name, data string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "orchestrator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfig(t, dir, "broken.yaml", `
+nodes:
+  - nodename: remote
+    os: linux
+    connection: {host: 10.0.0.1, port: 22, user: root, sshkey: /tmp/id_rsa}
+services:
+  - servicename: a
+    nodes: [remote]
+    dependson: [{servicename: missing}]
+`)
+	o := NewOrchestrator()
+	if _, err := o.LoadConfig(path); err == nil || !strings.Contains(err.Error(), "'missing' service") {
+		t.Fatalf("config with broken dependency is loaded or rejected by another error: %v", err)
+	}
+	if nodes := o.copyNodesAsMap(); len(nodes) != 0 {
+		t.Errorf("%d nodes are registered by rejected config", len(nodes))
+	}
+}
+
+// blockingStorage blocks saving of 'first' node until it is released
+type blockingStorage struct {
+	Storage
+	saving  chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStorage) Load() (*StorageState, error) { return &StorageState{}, nil }
+
+func (s *blockingStorage) SaveNode(node *Node) error {
+	if node.NodeName == "first" {
+		close(s.saving)
+		<-s.release
+	}
+	return nil
+}
+
+func (s *blockingStorage) DeleteNode(nodeName string) error { return nil }
+
+func (s *blockingStorage) SaveService(service *Service) error { return nil }
+
+func (s *blockingStorage) DeleteService(serviceName string) error { return nil }
+
+func (s *blockingStorage) SaveEvent(event *EventRecord) error { return nil }
+
+func TestConcurrentLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "orchestrator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfig(t, dir, "config.yaml", `
+nodes:
+  - nodename: first
+    os: linux
+    connection: {host: 10.0.0.1, port: 22, user: root, sshkey: /tmp/id_rsa}
+  - nodename: second
+    os: linux
+    connection: {host: 10.0.0.2, port: 22, user: root, sshkey: /tmp/id_rsa}
+`)
+	o := NewOrchestrator()
+	storage := &blockingStorage{saving: make(chan struct{}), release: make(chan struct{})}
+	if err := o.SetStorage(storage); err != nil {
+		t.Fatal(err)
+	}
+	loaded := make(chan error, 1)
+	go func() {
+		_, err := o.LoadConfig(path)
+		loaded <- err
+	}()
+	select {
+	case <-storage.saving: // config loading is in progress
+	case err := <-loaded:
+		t.Fatalf("config is not loaded: %v", err)
+	}
+	second := NewNode(&NodeInfo{NodeName: "second", OS: OSLinux, Connection: &Connection{Host: "10.0.0.3", Port: "22", User: "root", SSHKey: "/tmp/id_rsa"}})
+	registered := o.RegistrateNodes(second) == nil
+	close(storage.release)
+	if err := <-loaded; (err == nil) == registered {
+		t.Fatalf("both or none of config and node are registered: %v", err)
+	}
+	if _, err := o.GetNode("second"); err != nil {
+		t.Errorf("node is removed by another caller: %s", err.Error())
+	}
+}
+
+func TestReadConfigFormats(t *testing.T) {
+	os.Setenv("ORCHESTRATOR_TEST_HOST", "10.0.0.1")
+	defer os.Unsetenv("ORCHESTRATOR_TEST_HOST")
+	configs := map[string]string{
+		ConfigYAML: `
+logLevel: debug
+nodes:
+  - nodeName: remote
+    os: linux
+    connection: {host: "${ORCHESTRATOR_TEST_HOST}", port: 22, user: root, sshKey: /tmp/id_rsa}
+services:
+  - serviceName: web
+    nodes: [remote]
+    timeoutSeconds: ${ORCHESTRATOR_TEST_TIMEOUT:-5}
+    schedule: {interval: 500ms, jitter: -1}
+`,
+		ConfigJSON: `{
+  "LogLevel": "debug",
+  "Nodes": [{"NodeName": "remote", "OS": "linux",
+    "Connection": {"Host": "${ORCHESTRATOR_TEST_HOST}", "Port": 22, "User": "root", "SSHKey": "/tmp/id_rsa"}}],
+  "Services": [{"ServiceName": "web", "Nodes": ["remote"], "TimeoutSeconds": "${ORCHESTRATOR_TEST_TIMEOUT:-5}",
+    "Schedule": {"Interval": "500ms", "Jitter": -1}}]
+}`,
+		ConfigTOML: `
+logLevel = "debug"
+
+[[nodes]]
+nodeName = "remote"
+os = "linux"
+connection = {host = "${ORCHESTRATOR_TEST_HOST}", port = 22, user = "root", sshKey = "/tmp/id_rsa"}
+
+[[services]]
+serviceName = "web"
+nodes = ["remote"]
+timeoutSeconds = "${ORCHESTRATOR_TEST_TIMEOUT:-5}"
+schedule = {interval = "500ms", jitter = -1}
+`,
+	}
+	for format, data := range configs {
+		config, err := ReadConfig([]byte(data), format)
+		if err != nil {
+			t.Errorf("%s: %s", format, err.Error())
+			continue
+		}
+		if config.LogLevel != "debug" || len(config.nodes) != 1 || len(config.services) != 1 {
+			t.Errorf("%s: log level '%s', %d nodes and %d services", format, config.LogLevel, len(config.nodes), len(config.services))
+			continue
+		}
+		if c := config.nodes[0].Connection; c == nil || c.Host != "10.0.0.1" || c.Port != "22" {
+			t.Errorf("%s: unexpected connection %+v", format, c)
+		}
+		service := config.services[0]
+		if service.TimeoutSeconds != 5 || len(service.Nodes) != 1 || service.Nodes[0].NodeName != "remote" {
+			t.Errorf("%s: '%s' service has timeout %d and %d nodes", format, service.ServiceName, service.TimeoutSeconds, len(service.Nodes))
+		}
+		if service.Schedule.Interval != Duration(500*time.Millisecond) || service.Schedule.Jitter != -1 {
+			t.Errorf("%s: unexpected schedule %+v", format, service.Schedule)
+		}
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{"nodes:\n  - nodeName: a\n    os: linux\n  - nodeName: b\n    os: windows\n", "config:4: Node validation: unknown OS"},
+		{"nodes:\n  - nodeName: a\n    os: linux\n    port: 22\n", `config:2: json: unknown field "port"`},
+		{"services:\n  - serviceName: web\n    nodes: [missing]\n", "config:2: 'missing' node is not defined"},
+		{"logLevel: loud\n", "unknown 'loud' log level"},
+		{"nodes:\n  - nodeName: ${ORCHESTRATOR_TEST_UNSET}\n", "'ORCHESTRATOR_TEST_UNSET' is not set"},
+		{"nodes:\n  - {nodeName: a, os: linux}\nservices:\n  - serviceName: web\n    nodes: [a]\n    schedule: {interval: 1ns}\n",
+			"config:4: Schedule validation: interval"},
+	}
+	for _, test := range tests {
+		_, err := ReadConfig([]byte(test.config), ConfigYAML)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: error %v, expected %q", test.config, err, test.err)
+		}
+	}
+	dir, err := ioutil.TempDir("", "orchestrator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := ParseConfig(writeConfig(t, dir, "orchestrator.ini", "")); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("unknown format error: %v", err)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("ORCHESTRATOR_TEST_USER", "admin")
+	defer os.Unsetenv("ORCHESTRATOR_TEST_USER")
+	tests := map[string]string{
+		"${ORCHESTRATOR_TEST_USER}@host":       "admin@host",
+		"${ORCHESTRATOR_TEST_UNSET:-guest}":    "guest",
+		"${ORCHESTRATOR_TEST_USER:-guest}":     "admin",
+		"price: $$5":                           "price: $5",
+		"$ORCHESTRATOR_TEST_USER is unchanged": "$ORCHESTRATOR_TEST_USER is unchanged",
+	}
+	for s, expected := range tests {
+		if expanded, err := expandEnv(s); err != nil || expanded != expected {
+			t.Errorf("%q is expanded into %q (%v), expected %q", s, expanded, err, expected)
+		}
+	}
+}
+
+func TestParseExampleConfig(t *testing.T) {
+	config, err := ParseConfig(filepath.Join("example", "orchestrator.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.nodes) != 2 || len(config.services) != 1 {
+		t.Errorf("%d nodes and %d services, expected 2 and 1", len(config.nodes), len(config.services))
+	}
+}
@@ -9,8 +9,10 @@ const (
 	StatusPassed        = 0
 	StatusInactive      = 1
 	StatusDisconnected  = 1
+	StatusDegraded      = 2     // service is active on some but not all nodes
 	StatusFailed        = 0x200 // http access failed
 	StatusNilConnection = 0x400 // connection must be used, but it is null
+	StatusUnreachable   = 0x401 // service status can't be received from node
 	StatusUnknownNode   = 0x501 // node is not found by name
 	StatusUnknownOS     = 0x502 // undefined OS
 )
@@ -33,15 +35,34 @@ const (
 	LinuxTryIsActiveFormatString  = "systemctl is-active %s --quiet; echo $?"   // + ServiceConfiguration.ServiceName
 	DarwinTryIsActiveFormatString = "launchctl list | grep %s --quiet; echo $?" // + ServiceConfiguration.ServiceName
 
+	LinuxBatchIsActiveFormatString = "systemctl is-active %s; true" // + service names separated by space, one state per line
+	DarwinListFormatString         = "launchctl list"
+	LinuxInactiveExitCode          = 3 // exit code of systemctl is-active for not active service
+	LinuxUnknownExitCode           = 4 // exit code of systemctl is-active for unknown unit
+	DarwinNotListedExitCode        = 1 // exit code of grep for service which is not listed by launchctl
+
 	LinuxStartServiceFormatString  = "systemctl start %s" // + ServiceConfiguration.ServiceName
 	DarwinStartServiceFormatString = "launchctl start %s" // + ServiceConfiguration.ServiceName
 
 	LinuxStopServiceFormatString  = "systemctl stop %s" // + ServiceConfiguration.ServiceName
 	DarwinStopServiceFormatString = "launchctl stop %s" // + ServiceConfiguration.ServiceName
 
+	LinuxServiceLogsFormatString  = "journalctl -u %s -n %d --no-pager"                                              // + ServiceConfiguration.ServiceName, lines
+	DarwinServiceLogsFormatString = "log show --style syslog --last 1d --predicate 'process == \"%s\"' | tail -n %d" // + ServiceConfiguration.ServiceName, lines
+	DefaultLogLines               = 100
+
 	LinuxInstallingDebFormatString = "dpkg -i %s" // + ServiceTemplate.ServioceName
 )
 
+// AGGREGATION POLICIES of multi-node service status
+const (
+	AggregationAny        = "any"        // at least one node is active (default)
+	AggregationAll        = "all"        // all nodes are active, service is inactive if some of them are inactive
+	AggregationQuorum     = "quorum"     // more than half of nodes are active
+	AggregationAtLeast    = "at-least"   // at least Aggregation.Nodes nodes are active
+	AggregationPercentage = "percentage" // at least Aggregation.Percentage % of nodes are active
+)
+
 var HttpMethodMap = map[string]bool{
 	"GET":    true,
 	"POST":   true,
@@ -0,0 +1,278 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DEPENDENCY SCOPES
+const (
+	DependencyCluster = "cluster" // dependency must be active cluster-wide by its aggregation policy (default)
+	DependencyNode    = "node"    // dependency must be active on the same node
+)
+
+// DefaultDependencyTimeoutSeconds is a time of waiting for dependency to pass health checks
+const DefaultDependencyTimeoutSeconds = 60
+
+// Dependency is a service which must be healthy before dependent service is started
+type Dependency struct {
+	ServiceName    string
+	Scope          string // cluster / node
+	TimeoutSeconds int    // waiting for dependency health, DefaultDependencyTimeoutSeconds if 0
+}
+
+func (d *Dependency) Valid() error {
+	if d.ServiceName == "" {
+		return fmt.Errorf("Dependency validation: undefined service name")
+	}
+	switch d.Scope {
+	case "":
+		d.Scope = DependencyCluster
+	case DependencyCluster, DependencyNode:
+	default:
+		return fmt.Errorf("Dependency validation: unknown '%s' scope", d.Scope)
+	}
+	if d.TimeoutSeconds < 0 {
+		return fmt.Errorf("Dependency validation: timeout must not be negative")
+	}
+	if d.TimeoutSeconds == 0 {
+		d.TimeoutSeconds = DefaultDependencyTimeoutSeconds
+	}
+	return nil
+}
+
+// validDependencies checks that dependencies of services are defined and there are no cycles,
+// services are merged with registered ones, must be called under lock
+func (o *Orchestrator) validDependencies(services ...*Service) error {
+	all := make(map[string]*Service)
+	for name, service := range o.service {
+		all[name] = service
+	}
+	for _, service := range services {
+		all[service.ServiceName] = service
+	}
+	return o.validGraph(all, services...)
+}
+
+// validGraph checks dependencies of services within all services
+func (o *Orchestrator) validGraph(all map[string]*Service, services ...*Service) error {
+	for _, service := range services {
+		for _, dep := range service.DependsOn {
+			if dep.ServiceName == service.ServiceName {
+				return o.Errorf("'%s' service depends on itself", service.ServiceName)
+			}
+			dependency, exist := all[dep.ServiceName]
+			if !exist {
+				return o.Errorf("'%s' service depends on '%s' service which is not exist", service.ServiceName, dep.ServiceName)
+			}
+			if dep.Scope != DependencyNode {
+				continue
+			}
+			for _, node := range service.Nodes {
+				found := false
+				for _, n := range dependency.Nodes {
+					found = found || n.NodeName == node.NodeName
+				}
+				if !found {
+					return o.Errorf("'%s' service depends on '%s' service which has no '%s' node", service.ServiceName, dep.ServiceName, node.NodeName)
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	_, err := o.order(all, names)
+	return err
+}
+
+// order returns names with all their dependencies in topological order (dependencies first)
+func (o *Orchestrator) order(services map[string]*Service, names []string) ([]string, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	ordered := []string{}
+	path := []string{}
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return o.Errorf("dependency cycle: %s -> %s", strings.Join(path, " -> "), name)
+		}
+		service, exist := services[name]
+		if !exist {
+			return o.Errorf("'%s' service is not exist", name)
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range service.DependsOn {
+			if err := visit(dep.ServiceName); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		ordered = append(ordered, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// dependents returns names of services which depend on service directly, must be called under lock
+func (o *Orchestrator) dependents(serviceName string) []string {
+	names := []string{}
+	for _, service := range o.service {
+		for _, dep := range service.DependsOn {
+			if dep.ServiceName == serviceName {
+				names = append(names, service.ServiceName)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// StartServices starts services with their dependencies in topological order,
+// each service is started after its dependencies pass health checks
+func (o *Orchestrator) StartServices(names ...string) error {
+	services := o.copyServicesAsMap()
+	ordered, err := o.order(services, names)
+	if err != nil {
+		return err
+	}
+	for _, name := range ordered {
+		service := services[name]
+		for _, node := range service.Nodes {
+			for _, dep := range service.DependsOn {
+				if err := o.waitDependency(&dep, node.NodeName); err != nil {
+					return err
+				}
+			}
+			if err := o.StartService(node.NodeName, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// StopServices stops services with services which depend on them in reverse topological order
+func (o *Orchestrator) StopServices(names ...string) error {
+	o.mu.Lock()
+	group := make(map[string]bool)
+	queue := append([]string{}, names...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if group[name] {
+			continue
+		}
+		group[name] = true
+		queue = append(queue, o.dependents(name)...)
+	}
+	o.mu.Unlock()
+	services := o.copyServicesAsMap()
+	all := make([]string, 0, len(group))
+	for name := range group {
+		all = append(all, name)
+	}
+	ordered, err := o.order(services, all)
+	if err != nil {
+		return err
+	}
+	for i := len(ordered) - 1; i >= 0; i-- {
+		name := ordered[i]
+		if !group[name] {
+			continue
+		}
+		for _, node := range services[name].Nodes {
+			if err := o.StopService(node.NodeName, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// waitDependency waits until dependency is healthy on node or cluster-wide,
+// waiting is interrupted by Stop or Shutdown
+func (o *Orchestrator) waitDependency(dep *Dependency, nodeName string) error {
+	timeout := time.Duration(dep.TimeoutSeconds) * time.Second
+	if timeout < 1 {
+		timeout = DefaultDependencyTimeoutSeconds * time.Second
+	}
+	if err := o.waitHealthy(o.ctx, dep.ServiceName, nodeName, dep.Scope == DependencyNode, timeout); err != nil {
+		return o.Errorf("'%s' dependency: %s", dep.ServiceName, err.Error())
+	}
+	return nil
+}
+
+// waitHealthy polls service health on node (local) or cluster-wide until it passes or timeout is exceeded
+func (o *Orchestrator) waitHealthy(ctx context.Context, serviceName, nodeName string, local bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		healthy, err := o.healthy(serviceName, nodeName, local)
+		if err != nil {
+			return err
+		}
+		if healthy {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("'%s' service has not passed health checks in %s", serviceName, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// healthy probes service on node (local) or on all its nodes and checks http access
+func (o *Orchestrator) healthy(serviceName, nodeName string, local bool) (bool, error) {
+	service, err := o.GetService(serviceName)
+	if err != nil {
+		return false, err
+	}
+	for _, access := range service.HTTPAccess {
+		if err := access.do(service.Schedule.timeout()); err != nil {
+			return false, nil
+		}
+	}
+	active, total := 0, 0
+	for _, node := range service.Nodes {
+		if local && node.NodeName != nodeName {
+			continue
+		}
+		total++
+		if o.nodeActive(service, node) {
+			active++
+		}
+	}
+	if local {
+		return total > 0 && active == total, nil
+	}
+	return service.Aggregation.Satisfied(active, total), nil
+}
+
+// nodeActive probes service on node once, without check thresholds
+func (o *Orchestrator) nodeActive(service *Service, node *Node) bool {
+	if node.OS != OSLinux && node.OS != OSDarwin {
+		return false
+	}
+	status, _ := o.probe(node.NodeName, service.ServiceName, service.Schedule.timeout())
+	return status == ServiceStateActive
+}
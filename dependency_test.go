@@ -0,0 +1,70 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDependencyCycleRejected(t *testing.T) {
+	o := NewOrchestrator()
+	if err := o.RegistrateNodes(localNode()); err != nil {
+		t.Fatal(err)
+	}
+	a := NewService(&ServiceInfo{ServiceName: "a", DependsOn: []Dependency{{ServiceName: "b"}}}, localNode())
+	b := NewService(&ServiceInfo{ServiceName: "b", DependsOn: []Dependency{{ServiceName: "c"}}}, localNode())
+	c := NewService(&ServiceInfo{ServiceName: "c", DependsOn: []Dependency{{ServiceName: "a"}}}, localNode())
+	if err := o.RegistrateServices(a, b, c); err == nil || !strings.Contains(err.Error(), "dependency cycle") {
+		t.Errorf("services with dependency cycle are registered: %v", err)
+	}
+	if services := o.copyServicesAsArray(); len(services) != 0 {
+		t.Errorf("%d services are registered by rejected batch", len(services))
+	}
+}
+
+func TestMissingDependencyRejected(t *testing.T) {
+	o := NewOrchestrator()
+	if err := o.RegistrateNodes(localNode()); err != nil {
+		t.Fatal(err)
+	}
+	a := NewService(&ServiceInfo{ServiceName: "a", DependsOn: []Dependency{{ServiceName: "missing"}}}, localNode())
+	if err := o.RegistrateServices(a); err == nil || !strings.Contains(err.Error(), "'missing' service which is not exist") {
+		t.Errorf("service with missing dependency is registered: %v", err)
+	}
+	if err := o.RegistrateServices(NewService(&ServiceInfo{ServiceName: "b"}, localNode())); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.RemoveService("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.RegistrateServices(NewService(&ServiceInfo{ServiceName: "a", DependsOn: []Dependency{{ServiceName: "b"}}}, localNode())); err == nil {
+		t.Error("service with removed dependency is registered")
+	}
+}
+
+func TestStopInterruptsDependencyWait(t *testing.T) {
+	defer fakeCommand(t, "systemctl", "[ \"$1\" = is-active ] || exit 0\nshift\nfor unit in \"$@\"; do echo inactive; done\n")()
+	o := NewOrchestrator()
+	if err := o.RegistrateNodes(localNode()); err != nil {
+		t.Fatal(err)
+	}
+	b := NewService(&ServiceInfo{ServiceName: "b"}, localNode())
+	a := NewService(&ServiceInfo{ServiceName: "a", DependsOn: []Dependency{{ServiceName: "b", TimeoutSeconds: 60}}}, localNode())
+	if err := o.RegistrateServices(b, a); err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan error, 1)
+	go func() { started <- o.StartServices("a") }() // b never becomes active
+	time.Sleep(200 * time.Millisecond)
+	if err := o.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-started:
+		if err == nil {
+			t.Error("service is started although its dependency is not healthy")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("waiting for dependency is not interrupted by Stop")
+	}
+}
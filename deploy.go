@@ -0,0 +1,227 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// JOB TYPES of deployment
+const (
+	JobCanary    = "canary"
+	JobBlueGreen = "blue-green"
+)
+
+// CanaryPolicy sets deployment of package to canary nodes, which are watched
+// for a bake period before the package is rolled out to the rest of nodes
+type CanaryPolicy struct {
+	Nodes           []string // canary nodes, the first node of service if empty
+	BakeSeconds     int      // canary nodes must stay active during bake period
+	RollbackPackage string   // installed on canary nodes if canary has failed, nothing is rolled back if empty
+	RollingPolicy            // deployment to canary and to the rest of nodes
+}
+
+// BlueGreenPolicy sets deployment of package to idle (green) nodes and switching
+// service from live (blue) nodes to them, blue nodes are started back on failure
+type BlueGreenPolicy struct {
+	Blue                 []string // live nodes
+	Green                []string // idle nodes
+	Package              string   // path to debian package
+	PassPhrase           string   // pass phrase of ssh key for package installing
+	HealthTimeoutSeconds int
+	BakeSeconds          int // green nodes must stay active after switching
+}
+
+func (p *CanaryPolicy) Valid() error {
+	if p.Package == "" {
+		return errors.New("Canary policy validation: undefined package")
+	}
+	if p.BakeSeconds < 0 {
+		return errors.New("Canary policy validation: bake period must not be negative")
+	}
+	return p.RollingPolicy.Valid()
+}
+
+func (p *BlueGreenPolicy) Valid() error {
+	if p.Package == "" {
+		return errors.New("Blue/green policy validation: undefined package")
+	}
+	if len(p.Blue) < 1 || len(p.Green) < 1 {
+		return errors.New("Blue/green policy validation: blue and green nodes must be defined")
+	}
+	for _, blue := range p.Blue {
+		for _, green := range p.Green {
+			if blue == green {
+				return errors.New("Blue/green policy validation: '" + blue + "' node is both blue and green")
+			}
+		}
+	}
+	if p.HealthTimeoutSeconds < 0 || p.BakeSeconds < 0 {
+		return errors.New("Blue/green policy validation: intervals must not be negative")
+	}
+	if p.HealthTimeoutSeconds == 0 {
+		p.HealthTimeoutSeconds = DefaultHealthTimeoutSeconds
+	}
+	return nil
+}
+
+// Canary starts canary deployment of service as a job
+func (o *Orchestrator) Canary(serviceName string, policy CanaryPolicy) (*Job, error) {
+	if err := policy.Valid(); err != nil {
+		return nil, err
+	}
+	service, err := o.GetService(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	if len(policy.Nodes) < 1 {
+		policy.Nodes = []string{service.Nodes[0].NodeName}
+	}
+	canary, err := o.serviceNodes(service, policy.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	rest := []*Node{}
+	for _, node := range service.Nodes {
+		if !inNodes(canary, node.NodeName) {
+			rest = append(rest, node)
+		}
+	}
+	return o.runJob(JobCanary, serviceName, func(ctx context.Context, job *Job) error {
+		err := o.roll(ctx, job, service, canary, &policy.RollingPolicy)
+		if err == nil {
+			err = o.bake(ctx, job, serviceName, canary, policy.BakeSeconds)
+		}
+		if err != nil {
+			if ctx.Err() == nil && policy.RollbackPackage != "" {
+				for _, node := range canary {
+					o.restart(job, node.NodeName, serviceName, policy.RollbackPackage, policy.PassPhrase)
+				}
+				return o.Errorf("canary has failed and has been rolled back: %s", err.Error())
+			}
+			return o.Errorf("canary has failed: %s", err.Error())
+		}
+		return o.roll(ctx, job, service, rest, &policy.RollingPolicy)
+	}), nil
+}
+
+// BlueGreen starts blue/green deployment of service as a job
+func (o *Orchestrator) BlueGreen(serviceName string, policy BlueGreenPolicy) (*Job, error) {
+	if err := policy.Valid(); err != nil {
+		return nil, err
+	}
+	service, err := o.GetService(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	blue, err := o.serviceNodes(service, policy.Blue)
+	if err != nil {
+		return nil, err
+	}
+	green, err := o.serviceNodes(service, policy.Green)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(policy.HealthTimeoutSeconds) * time.Second
+	return o.runJob(JobBlueGreen, serviceName, func(ctx context.Context, job *Job) error {
+		stopGreen := func() {
+			for _, node := range green {
+				o.step(job, node.NodeName, "stop", o.StopService(node.NodeName, serviceName))
+			}
+		}
+		for _, node := range green {
+			err := o.restart(job, node.NodeName, serviceName, policy.Package, policy.PassPhrase)
+			if err == nil {
+				err = o.waitHealthy(ctx, serviceName, node.NodeName, true, timeout)
+				o.step(job, node.NodeName, "health-check", err)
+			}
+			if err != nil {
+				stopGreen()
+				return o.Errorf("green '%s' node has failed, blue nodes stay live: %s", node.NodeName, err.Error())
+			}
+		}
+		o.switchDesiredState(service, green, blue)
+		for _, node := range blue {
+			o.step(job, node.NodeName, "stop", o.StopService(node.NodeName, serviceName))
+		}
+		if err := o.bake(ctx, job, serviceName, green, policy.BakeSeconds); err != nil {
+			o.switchDesiredState(service, blue, green)
+			for _, node := range blue {
+				o.step(job, node.NodeName, "start", o.StartService(node.NodeName, serviceName))
+			}
+			for _, node := range blue {
+				o.step(job, node.NodeName, "health-check", o.waitHealthy(o.ctx, serviceName, node.NodeName, true, timeout))
+			}
+			stopGreen()
+			return o.Errorf("green nodes have failed, switched back to blue nodes: %s", err.Error())
+		}
+		return nil
+	}), nil
+}
+
+// bake watches service status on nodes by status routine during bake period
+// and checks health of nodes at the end of it
+func (o *Orchestrator) bake(ctx context.Context, job *Job, serviceName string, nodes []*Node, seconds int) error {
+	events, cancel := o.Subscribe(&EventFilter{Services: []string{serviceName}, Types: []string{EventStatusChanged}})
+	defer cancel()
+	timer := time.NewTimer(time.Duration(seconds) * time.Second)
+	defer timer.Stop()
+	for done := false; !done; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-events:
+			if e.Node != "" && inNodes(nodes, e.Node) && isKnown(e.To) && e.To != ServiceStateActive {
+				err := o.Errorf("'%s' service is %s on '%s' node during bake period", serviceName, e.To, e.Node)
+				o.step(job, e.Node, "bake", err)
+				return err
+			}
+		case <-timer.C:
+			done = true
+		}
+	}
+	for _, node := range nodes {
+		healthy, err := o.healthy(serviceName, node.NodeName, true)
+		if err == nil && !healthy {
+			err = o.Errorf("'%s' service has not passed health checks on '%s' node after bake period", serviceName, node.NodeName)
+		}
+		o.step(job, node.NodeName, "bake", err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serviceNodes returns nodes of service by names
+func (o *Orchestrator) serviceNodes(service *Service, names []string) ([]*Node, error) {
+	nodes := []*Node{}
+	for _, name := range names {
+		found := false
+		for _, node := range service.Nodes {
+			if node.NodeName == name {
+				nodes = append(nodes, node)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, o.Errorf("'%s' service has no '%s' node", service.ServiceName, name)
+		}
+	}
+	return nodes, nil
+}
+
+// switchDesiredState updates desired states of nodes managed by reconciler
+func (o *Orchestrator) switchDesiredState(service *Service, running, stopped []*Node) {
+	for _, node := range running {
+		if _, managed := service.DesiredState[node.NodeName]; managed {
+			o.SetDesiredState(service.ServiceName, node.NodeName, DesiredRunning)
+		}
+	}
+	for _, node := range stopped {
+		if _, managed := service.DesiredState[node.NodeName]; managed {
+			o.SetDesiredState(service.ServiceName, node.NodeName, DesiredStopped)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanary(t *testing.T) {
+	cluster := newFakeCluster(t, "n1", "n2", "n3")
+	defer cluster.Close()
+	o := NewOrchestrator()
+	defer o.Stop()
+	cluster.register(o, &ServiceInfo{ServiceName: "s", Schedule: Schedule{Interval: -1}})
+
+	job, err := o.Canary("s", CanaryPolicy{Nodes: []string{"n2"}, RollingPolicy: RollingPolicy{Package: cluster.packages["good.deb"]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitJob(t, o, job.ID)
+	if job.Type != JobCanary || job.State != JobSucceeded {
+		t.Fatalf("%s job is %s: %s", job.Type, job.State, job.Error)
+	}
+	cluster.expectLog(
+		"n2 install good.deb", "n2 stop", "n2 start", // canary
+		"n1 install good.deb", "n1 stop", "n1 start",
+		"n3 install good.deb", "n3 stop", "n3 start",
+	)
+	if _, err := o.Canary("s", CanaryPolicy{Nodes: []string{"unknown"}, RollingPolicy: RollingPolicy{Package: "good.deb"}}); err == nil {
+		t.Error("canary on unknown node is started")
+	}
+	if _, err := o.Canary("s", CanaryPolicy{}); err == nil {
+		t.Error("canary without package is started")
+	}
+}
+
+func TestCanaryRollback(t *testing.T) {
+	cluster := newFakeCluster(t, "n1", "n2")
+	defer cluster.Close()
+	o := NewOrchestrator()
+	defer o.Stop()
+	cluster.register(o, &ServiceInfo{ServiceName: "s", Schedule: Schedule{Interval: -1}})
+
+	job, err := o.Canary("s", CanaryPolicy{
+		RollbackPackage: cluster.packages["good.deb"],
+		RollingPolicy:   RollingPolicy{Package: cluster.packages["bad.deb"], HealthTimeoutSeconds: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitJob(t, o, job.ID)
+	if job.State != JobFailed || !strings.Contains(job.Error, "rolled back") {
+		t.Fatalf("job is %s: %s, expected failed and rolled back", job.State, job.Error)
+	}
+	cluster.expectLog(
+		"n1 install bad.deb", "n1 stop", "n1 start",
+		"n1 install good.deb", "n1 stop", "n1 start", // rollback, n2 is untouched
+	)
+}
+
+func TestBlueGreen(t *testing.T) {
+	cluster := newFakeCluster(t, "blue", "green")
+	defer cluster.Close()
+	o := NewOrchestrator()
+	defer o.Stop()
+	cluster.register(o, &ServiceInfo{ServiceName: "s", Schedule: Schedule{Interval: -1}})
+	for node, state := range map[string]string{"blue": DesiredRunning, "green": DesiredStopped} {
+		if err := o.SetDesiredState("s", node, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy := BlueGreenPolicy{Blue: []string{"blue"}, Green: []string{"green"}, Package: cluster.packages["good.deb"]}
+	job, err := o.BlueGreen("s", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitJob(t, o, job.ID)
+	if job.Type != JobBlueGreen || job.State != JobSucceeded {
+		t.Fatalf("%s job is %s: %s", job.Type, job.State, job.Error)
+	}
+	cluster.expectLog("green install good.deb", "green stop", "green start", "blue stop")
+	service, err := o.GetService("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.DesiredState["green"] != DesiredRunning || service.DesiredState["blue"] != DesiredStopped {
+		t.Errorf("desired states are not switched: %v", service.DesiredState)
+	}
+	policy.Green = policy.Blue
+	if _, err := o.BlueGreen("s", policy); err == nil {
+		t.Error("blue/green deployment with the same blue and green node is started")
+	}
+}
+
+func TestBlueGreenKeepsBlueOnFailure(t *testing.T) {
+	cluster := newFakeCluster(t, "blue", "green")
+	defer cluster.Close()
+	o := NewOrchestrator()
+	defer o.Stop()
+	cluster.register(o, &ServiceInfo{ServiceName: "s", Schedule: Schedule{Interval: -1}})
+
+	job, err := o.BlueGreen("s", BlueGreenPolicy{Blue: []string{"blue"}, Green: []string{"green"},
+		Package: cluster.packages["bad.deb"], HealthTimeoutSeconds: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitJob(t, o, job.ID)
+	if job.State != JobFailed {
+		t.Fatalf("job is %s, expected failed", job.State)
+	}
+	cluster.expectLog("green install bad.deb", "green stop", "green start", "green stop") // blue stays live
+}
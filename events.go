@@ -0,0 +1,263 @@
+package orchestrator
+
+import (
+	"errors"
+	"time"
+)
+
+// EVENT TYPES
+const (
+	EventStatusChecked     = "status-checked"      // service status has been evaluated
+	EventStatusChanged     = "status-changed"      // service status has been changed (on node if Node is set)
+	EventCheckFailed       = "check-failed"        // HTTP access check has failed
+	EventNodeConnected     = "node-connected"      // node has been connected
+	EventNodeDisconnected  = "node-disconnected"   // node has been disconnected
+	EventServiceStarted    = "service-started"     // service has been started on node
+	EventServiceStopped    = "service-stopped"     // service has been stopped on node
+	EventAlertFiring       = "alert-firing"        // alert rule has fired
+	EventAlertResolved     = "alert-resolved"      // alert has been resolved
+	EventRemediation       = "remediation"         // service restart has been attempted, Error is set on failure
+	EventRemediationGaveUp = "remediation-gave-up" // restart policy has given up
+	EventDrift             = "drift"               // service state on node differs from desired state
+	EventJobFinished       = "job-finished"        // rollout or deployment job has been finished
+	EventConfigReloaded    = "config-reloaded"     // configuration has been reloaded, Error is set on failure
+)
+
+// NotableEventTypes are all event types except status-checked
+var NotableEventTypes = []string{
+	EventStatusChanged, EventCheckFailed,
+	EventNodeConnected, EventNodeDisconnected,
+	EventServiceStarted, EventServiceStopped,
+	EventAlertFiring, EventAlertResolved,
+	EventRemediation, EventRemediationGaveUp,
+	EventDrift, EventJobFinished, EventConfigReloaded,
+}
+
+// SUBSCRIBER POLICIES when subscriber's buffer is full
+const (
+	DropNewest = "drop-newest" // new event is dropped (default)
+	DropOldest = "drop-oldest" // the oldest buffered event is dropped
+)
+
+// DefaultSubscriberBuffer is a default size of subscriber's channel
+const DefaultSubscriberBuffer = 64
+
+type Event struct {
+	ID      uint64
+	Type    string
+	Time    time.Time
+	Service string
+	Node    string
+	From    ServiceState // for status-changed event
+	To      ServiceState // for status-changed event
+	Status  ServiceStatusInfo
+	Alert   *Alert // for alert events
+	Error   error  `json:"-"`
+}
+
+func (e *Event) copy() Event {
+	cp := *e
+	cp.Status = e.Status.copy()
+	if e.Alert != nil {
+		alert := *e.Alert
+		cp.Alert = &alert
+	}
+	return cp
+}
+
+// EventFilter selects events for subscriber, empty field matches everything
+type EventFilter struct {
+	Services []string
+	Nodes    []string
+	Types    []string
+	From     []ServiceState // status-changed events only
+	To       []ServiceState // status-changed events only
+	Buffer   int            // size of subscriber's channel
+	Policy   string         // drop-newest / drop-oldest
+}
+
+func (f *EventFilter) copy() EventFilter {
+	cp := *f
+	cp.Services = append([]string(nil), f.Services...)
+	cp.Nodes = append([]string(nil), f.Nodes...)
+	cp.Types = append([]string(nil), f.Types...)
+	cp.From = append([]ServiceState(nil), f.From...)
+	cp.To = append([]ServiceState(nil), f.To...)
+	return cp
+}
+
+type subscriber struct {
+	filter EventFilter
+	ch     chan Event
+}
+
+func (f *EventFilter) Match(e *Event) bool {
+	if len(f.Services) > 0 && !containsString(f.Services, e.Service) {
+		return false
+	}
+	if len(f.Nodes) > 0 && !containsString(f.Nodes, e.Node) {
+		return false
+	}
+	if len(f.Types) > 0 && !containsString(f.Types, e.Type) {
+		return false
+	}
+	if len(f.From) > 0 && (e.Type != EventStatusChanged || !containsState(f.From, e.From)) {
+		return false
+	}
+	if len(f.To) > 0 && (e.Type != EventStatusChanged || !containsState(f.To, e.To)) {
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsState(values []ServiceState, value ServiceState) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe returns channel of events matched by filter (nil filter matches everything)
+// and cancel function which closes the channel. Events are fanned out without blocking:
+// when subscriber's buffer is full events are dropped according to filter's policy
+func (o *Orchestrator) Subscribe(filter *EventFilter) (<-chan Event, func()) {
+	sub := &subscriber{EventFilter{}, nil}
+	if filter != nil {
+		sub.filter = filter.copy()
+	}
+	if sub.filter.Buffer < 1 {
+		sub.filter.Buffer = DefaultSubscriberBuffer
+	}
+	sub.ch = make(chan Event, sub.filter.Buffer)
+	o.mu.Lock()
+	if o.ctx.Err() != nil { // orchestrator is stopped
+		o.mu.Unlock()
+		close(sub.ch)
+		return sub.ch, func() {}
+	}
+	o.subID++
+	id := o.subID
+	o.subscriber[id] = sub
+	o.mu.Unlock()
+	cancel := func() {
+		o.mu.Lock()
+		if _, exist := o.subscriber[id]; exist {
+			delete(o.subscriber, id)
+			close(sub.ch)
+		}
+		o.mu.Unlock()
+	}
+	return sub.ch, cancel
+}
+
+// publish fans event out to subscribers and persists it,
+// must be called without lock
+func (o *Orchestrator) publish(e Event) {
+	dropped := 0
+	o.mu.Lock()
+	o.eventID++
+	e.ID = o.eventID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Type != EventStatusChecked || e.Error != nil {
+		o.recent = append(o.recent, e.copy())
+		if len(o.recent) > o.hLimit {
+			o.recent = append([]Event{}, o.recent[len(o.recent)-o.hLimit:]...)
+		}
+	}
+	for _, sub := range o.subscriber {
+		if !sub.filter.Match(&e) {
+			continue
+		}
+		select {
+		case sub.ch <- e.copy():
+			continue
+		default:
+		}
+		if sub.filter.Policy == DropOldest {
+			select {
+			case <-sub.ch:
+			default:
+			}
+			select {
+			case sub.ch <- e.copy():
+				continue
+			default:
+			}
+		}
+		dropped++
+	}
+	o.mu.Unlock()
+	if dropped > 0 {
+		o.logf(DEBUG, "'%s' event #%d has been dropped for %d subscribers", e.Type, e.ID, dropped)
+	}
+	if e.Type != EventStatusChecked || e.Error != nil {
+		o.persist(func(s Storage) error { return s.SaveEvent(e.record()) })
+	}
+}
+
+// LastEventID returns ID of the last published event, IDs are restarted with orchestrator if storage is not set
+func (o *Orchestrator) LastEventID() uint64 {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.eventID
+}
+
+// EventsSince returns recent events with ID greater than id matched by filter,
+// status-checked events are not kept
+func (o *Orchestrator) EventsSince(id uint64, filter *EventFilter) []Event {
+	if filter == nil {
+		filter = &EventFilter{}
+	}
+	events := []Event{}
+	o.mu.RLock()
+	for _, e := range o.recent {
+		if e.ID > id && filter.Match(&e) {
+			events = append(events, e.copy())
+		}
+	}
+	o.mu.RUnlock()
+	return events
+}
+
+func (e *Event) record() *EventRecord {
+	record := &EventRecord{e.ID, e.Type, e.Time, e.Service, e.Node, nil, nil, nil, e.Alert, ""}
+	switch e.Type {
+	case EventStatusChanged:
+		from, to, status := e.From, e.To, e.Status
+		record.From, record.To, record.Status = &from, &to, &status
+	case EventStatusChecked, EventCheckFailed:
+		status := e.Status
+		record.Status = &status
+	}
+	if e.Error != nil {
+		record.Error = e.Error.Error()
+	}
+	return record
+}
+
+func (r *EventRecord) event() Event {
+	e := Event{ID: r.ID, Type: r.Type, Time: r.Time, Service: r.Service, Node: r.Node, Alert: r.Alert}
+	if r.From != nil && r.To != nil {
+		e.From, e.To = *r.From, *r.To
+	}
+	if r.Status != nil {
+		e.Status = *r.Status
+	}
+	if r.Error != "" {
+		e.Error = errors.New(r.Error)
+	}
+	return e
+}
@@ -0,0 +1,161 @@
+package orchestrator
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamEvents connects to event stream with Last-Event-ID and returns channel of received event IDs
+func streamEvents(t *testing.T, ctx context.Context, url, lastID string) <-chan uint64 {
+	req, err := http.NewRequest(http.MethodGet, url+"/orchestrator/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", lastID)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(chan uint64, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(ids)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "id: ") {
+				id, _ := strconv.ParseUint(strings.TrimPrefix(line, "id: "), 10, 64)
+				ids <- id
+			}
+		}
+	}()
+	return ids
+}
+
+func expectEventIDs(t *testing.T, ids <-chan uint64, expected ...uint64) {
+	for _, id := range expected {
+		select {
+		case received := <-ids:
+			if received != id {
+				t.Fatalf("event #%d is received, expected #%d", received, id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event #%d is not received", id)
+		}
+	}
+}
+
+func TestStreamEventsResume(t *testing.T) {
+	o := NewOrchestrator()
+	for i := 0; i < 3; i++ {
+		o.publish(Event{Type: EventDrift, Service: "a"})
+	}
+	server := httptest.NewServer(o.Server())
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	expectEventIDs(t, streamEvents(t, ctx, server.URL, "1"), 2, 3)
+
+	// client has seen events of orchestrator before restart
+	ids := streamEvents(t, ctx, server.URL, "100")
+	expectEventIDs(t, ids, 1, 2, 3)
+	o.publish(Event{Type: EventDrift, Service: "a"})
+	expectEventIDs(t, ids, 4)
+}
+
+func TestSubscribeFilter(t *testing.T) {
+	o := NewOrchestrator()
+	ch, cancel := o.Subscribe(&EventFilter{Services: []string{"s"}, Types: []string{EventStatusChanged}, To: []ServiceState{StatusInactive}})
+	defer cancel()
+	o.publish(Event{Type: EventStatusChanged, Service: "s", From: StatusActive, To: StatusInactive})
+	o.publish(Event{Type: EventStatusChanged, Service: "s", From: StatusInactive, To: StatusActive})
+	o.publish(Event{Type: EventStatusChanged, Service: "other", From: StatusActive, To: StatusInactive})
+	o.publish(Event{Type: EventServiceStopped, Service: "s", Node: "n"})
+	select {
+	case e := <-ch:
+		if e.ID != 1 || e.To != StatusInactive {
+			t.Errorf("event #%d %s -> %s, expected #1 active -> inactive", e.ID, e.From, e.To)
+		}
+	default:
+		t.Fatal("matched event is not received")
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("unmatched event #%d '%s' is received", e.ID, e.Type)
+	default:
+	}
+	if events := o.EventsSince(1, &EventFilter{Services: []string{"s"}}); len(events) != 2 {
+		t.Errorf("%d recent events since #1, expected 2", len(events))
+	}
+}
+
+func TestSubscribeDropPolicy(t *testing.T) {
+	o := NewOrchestrator()
+	newest, cancelNewest := o.Subscribe(&EventFilter{Buffer: 2})
+	defer cancelNewest()
+	oldest, cancelOldest := o.Subscribe(&EventFilter{Buffer: 2, Policy: DropOldest})
+	defer cancelOldest()
+	for i := 0; i < 4; i++ {
+		o.publish(Event{Type: EventDrift, Service: "s"})
+	}
+	received := func(ch <-chan Event) []uint64 {
+		ids := []uint64{}
+		for len(ch) > 0 {
+			ids = append(ids, (<-ch).ID)
+		}
+		return ids
+	}
+	if ids := received(newest); len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("%s subscriber has received %v, expected [1 2]", DropNewest, ids)
+	}
+	if ids := received(oldest); len(ids) != 2 || ids[0] != 3 || ids[1] != 4 {
+		t.Errorf("%s subscriber has received %v, expected [3 4]", DropOldest, ids)
+	}
+}
+
+func TestSubscriptionClosed(t *testing.T) {
+	o := NewOrchestrator()
+	ch, cancel := o.Subscribe(nil)
+	cancel()
+	cancel() // repeated cancellation is no-op
+	if _, open := <-ch; open {
+		t.Error("channel is open after cancellation")
+	}
+	ch, cancel = o.Subscribe(nil)
+	defer cancel()
+	if err := o.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, open := <-ch; open {
+		t.Error("channel is open after stop")
+	}
+	ch, _ = o.Subscribe(nil)
+	if _, open := <-ch; open {
+		t.Error("channel of stopped orchestrator is open")
+	}
+}
+
+func TestSubscribeStatusChanged(t *testing.T) {
+	defer fakeSystemctl(t)()
+	o := startOrchestrator(t)
+	defer o.Stop()
+	ch, cancel := o.Subscribe(&EventFilter{Types: []string{EventStatusChanged}})
+	defer cancel()
+	if err := o.RegistrateServices(NewService(&ServiceInfo{ServiceName: "s", TimeoutSeconds: 1}, localNode())); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-ch:
+		if e.Service != "s" || e.To != StatusActive {
+			t.Errorf("'%s' service has changed status to %s, expected 's' and active", e.Service, e.To)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("status-changed event is not received")
+	}
+}
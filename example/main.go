@@ -1,7 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/mariiatuzovska/orchestrator"
 )
@@ -40,7 +46,7 @@ func main() {
 	}, node1)
 
 	orch := orchestrator.NewOrchestrator()
-	go orch.Start()
+	go orch.Start(context.Background())
 
 	if err := orch.RegistrateNodes(node1, node2); err != nil {
 		log.Fatal(err)
@@ -51,7 +57,19 @@ func main() {
 
 	orch.SetLogLevel(orchestrator.INFO)
 
-	if err := orch.Server().Start("127.0.0.1:8080"); err != nil {
+	server := orch.Server()
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	if err := server.Start("127.0.0.1:8080"); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
 
@@ -3,6 +3,7 @@ module github.com/mariiatuzovska/orchestrator
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible // indirect
 	github.com/go-cmd/cmd v1.2.0 // indirect
 	github.com/google/go-cmp v0.5.1 // indirect
@@ -13,5 +14,6 @@ require (
 	github.com/urfave/cli v1.22.4
 	golang.org/x/crypto v0.0.0-20200709230013-948cd5f35899
 	golang.org/x/sys v0.0.0-20200625212154-ddb9806d33ae // indirect
+	gopkg.in/yaml.v3 v3.0.1
 	gotest.tools v2.2.0+incompatible
 )
@@ -0,0 +1,229 @@
+package orchestrator
+
+import (
+	"time"
+)
+
+// DefaultHistoryLimit is a maximum number of transitions kept per service and per node
+const DefaultHistoryLimit = 1024
+
+// Transition is a change of service state
+type Transition struct {
+	Time time.Time
+	From ServiceState
+	To   ServiceState
+	Up   bool // service's aggregation policy is satisfied or node's service is active after transition
+}
+
+// UptimeReport describes service availability over window
+type UptimeReport struct {
+	From            time.Time
+	To              time.Time
+	ObservedSeconds float64 // time with known state inside window
+	UptimeSeconds   float64
+	Uptime          float64 // percentage of observed time
+	Failures        int     // up -> down transitions
+	Recoveries      int     // down -> up transitions
+	MTTRSeconds     float64 // mean time to recovery, outages which have not been recovered are not counted
+	MTBFSeconds     float64 // mean time between failures
+}
+
+type ServiceHistory struct {
+	ServiceName string
+	Transitions []Transition
+	Uptime      UptimeReport
+	Nodes       []*NodeHistory
+}
+
+type NodeHistory struct {
+	NodeName    string
+	Transitions []Transition
+	Uptime      UptimeReport
+}
+
+type statusHistory struct {
+	service []Transition
+	node    map[string][]Transition
+}
+
+func (o *Orchestrator) SetHistoryLimit(limit int) {
+	o.mu.Lock()
+	if limit > 0 {
+		o.hLimit = limit
+	} else {
+		o.hLimit = DefaultHistoryLimit
+	}
+	o.mu.Unlock()
+}
+
+// recordHistory appends transitions between previous and current service status
+// and returns status-changed events, must be called under lock
+func (o *Orchestrator) recordHistory(serviceName string, prev, cur *ServiceStatusInfo) []Event {
+	changes := []Event{}
+	h, exist := o.history[serviceName]
+	if !exist {
+		h = &statusHistory{[]Transition{}, make(map[string][]Transition)}
+		o.history[serviceName] = h
+	}
+	if prev.ServiceStatus != cur.ServiceStatus {
+		h.service = o.appendTransition(h.service, Transition{cur.ThisUpdate, prev.ServiceStatus, cur.ServiceStatus, o.isServiceUp(serviceName, cur)})
+		changes = append(changes, Event{
+			Type: EventStatusChanged, Time: cur.ThisUpdate, Service: serviceName,
+			From: prev.ServiceStatus, To: cur.ServiceStatus, Status: *cur,
+		})
+	}
+	prevNodes := make(map[string]ServiceState)
+	for _, n := range prev.NodeStatus {
+		prevNodes[n.NodeName] = n.ServiceStatus
+	}
+	for _, n := range cur.NodeStatus {
+		from, ok := prevNodes[n.NodeName]
+		if !ok {
+			from = ServiceStateInitialized
+		}
+		if from != n.ServiceStatus {
+			h.node[n.NodeName] = o.appendTransition(h.node[n.NodeName], Transition{cur.ThisUpdate, from, n.ServiceStatus, n.ServiceStatus == ServiceStateActive})
+			changes = append(changes, Event{
+				Type: EventStatusChanged, Time: cur.ThisUpdate, Service: serviceName, Node: n.NodeName,
+				From: from, To: n.ServiceStatus, Status: *cur,
+			})
+		}
+	}
+	return changes
+}
+
+func (o *Orchestrator) appendTransition(transitions []Transition, t Transition) []Transition {
+	transitions = append(transitions, t)
+	if len(transitions) > o.hLimit {
+		transitions = append([]Transition{}, transitions[len(transitions)-o.hLimit:]...)
+	}
+	return transitions
+}
+
+// History returns service and service's nodes transitions with uptime report
+// over [from, to] window, zero from means the beginning of history, zero to means now
+func (o *Orchestrator) History(serviceName string, from, to time.Time) (*ServiceHistory, error) {
+	if _, err := o.GetService(serviceName); err != nil {
+		return nil, err
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if !from.IsZero() && from.After(to) {
+		return nil, o.Errorf("history window: from '%s' is after to '%s'", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	history := &ServiceHistory{serviceName, []Transition{}, UptimeReport{}, []*NodeHistory{}}
+	h, exist := o.history[serviceName]
+	if !exist {
+		history.Uptime = uptime(nil, from, to)
+		return history, nil
+	}
+	history.Transitions = transitionsInWindow(h.service, from, to)
+	history.Uptime = uptime(h.service, from, to)
+	for nodeName, transitions := range h.node {
+		history.Nodes = append(history.Nodes, &NodeHistory{
+			nodeName,
+			transitionsInWindow(transitions, from, to),
+			uptime(transitions, from, to),
+		})
+	}
+	return history, nil
+}
+
+// isServiceUp returns true if service status satisfies aggregation policy of service, must be called under lock
+func (o *Orchestrator) isServiceUp(serviceName string, status *ServiceStatusInfo) bool {
+	if status.ServiceStatus == ServiceStateActive {
+		return true
+	}
+	service, exist := o.service[serviceName]
+	if !exist || status.ServiceStatus != ServiceStateDegraded {
+		return false
+	}
+	active := 0
+	for _, n := range status.NodeStatus {
+		if n.ServiceStatus == ServiceStateActive {
+			active++
+		}
+	}
+	return service.Aggregation.Satisfied(active, len(service.Nodes))
+}
+
+func isKnown(s ServiceState) bool {
+	return s != ServiceStateInitialized && s != ServiceStateUndefined
+}
+
+func transitionsInWindow(transitions []Transition, from, to time.Time) []Transition {
+	result := []Transition{}
+	for _, t := range transitions {
+		if t.Time.Before(from) || t.Time.After(to) {
+			continue
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+// uptime walks transitions and accumulates up/down durations inside window,
+// state before the first transition is up if it is active
+func uptime(transitions []Transition, from, to time.Time) UptimeReport {
+	report := UptimeReport{From: from, To: to}
+	if len(transitions) < 1 {
+		return report
+	}
+	if from.IsZero() || from.Before(transitions[0].Time) {
+		from = transitions[0].Time
+		report.From = from
+	}
+	var upTime, downTime time.Duration
+	var outage, repairTime time.Duration // current outage and outages ended by recovery
+	wasUp := transitions[0].From == ServiceStateActive
+	for i, t := range transitions {
+		end := to
+		if i+1 < len(transitions) {
+			end = transitions[i+1].Time
+		}
+		start := t.Time
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !t.Time.Before(from) && !t.Time.After(to) && isKnown(t.From) && isKnown(t.To) {
+			if wasUp && !t.Up {
+				report.Failures++
+			} else if !wasUp && t.Up {
+				report.Recoveries++
+				repairTime += outage
+			}
+		}
+		wasUp = t.Up
+		if t.Up || !isKnown(t.To) {
+			outage = 0
+		}
+		if !end.After(start) || !isKnown(t.To) {
+			continue
+		}
+		if t.Up {
+			upTime += end.Sub(start)
+		} else {
+			downTime += end.Sub(start)
+			outage += end.Sub(start)
+		}
+	}
+	observed := upTime + downTime
+	report.ObservedSeconds = observed.Seconds()
+	report.UptimeSeconds = upTime.Seconds()
+	if observed > 0 {
+		report.Uptime = 100 * upTime.Seconds() / observed.Seconds()
+	}
+	if report.Recoveries > 0 {
+		report.MTTRSeconds = repairTime.Seconds() / float64(report.Recoveries)
+	}
+	if report.Failures > 0 {
+		report.MTBFSeconds = upTime.Seconds() / float64(report.Failures)
+	}
+	return report
+}
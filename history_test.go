@@ -0,0 +1,85 @@
+package orchestrator
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestUptimeCountsRecoveredOutagesOnly(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return t0.Add(time.Duration(seconds) * time.Second) }
+	transitions := []Transition{
+		{at(0), ServiceStateInitialized, ServiceStateActive, true},
+		{at(10), ServiceStateActive, ServiceStateInactive, false},
+		{at(13), ServiceStateInactive, ServiceStateUnreachable, false},
+		{at(15), ServiceStateUnreachable, ServiceStateActive, true}, // recovered after 5s
+		{at(30), ServiceStateActive, ServiceStateInactive, false},   // is not recovered
+	}
+	report := uptime(transitions, time.Time{}, at(50))
+	if report.Failures != 2 || report.Recoveries != 1 {
+		t.Errorf("%d failures and %d recoveries, expected 2 and 1", report.Failures, report.Recoveries)
+	}
+	if report.ObservedSeconds != 50 || report.UptimeSeconds != 25 || report.Uptime != 50 {
+		t.Errorf("%v of %v seconds is up (%v%%), expected 25 of 50 (50%%)", report.UptimeSeconds, report.ObservedSeconds, report.Uptime)
+	}
+	if report.MTTRSeconds != 5 {
+		t.Errorf("MTTR is %v seconds, expected 5", report.MTTRSeconds)
+	}
+	if report.MTBFSeconds != 12.5 {
+		t.Errorf("MTBF is %v seconds, expected 12.5", report.MTBFSeconds)
+	}
+}
+
+func TestHistoryDegradedByPolicy(t *testing.T) {
+	o := NewOrchestrator()
+	nodes := []*Node{}
+	for i := 1; i <= 3; i++ {
+		nodes = append(nodes, NewNode(&NodeInfo{NodeName: fmt.Sprintf("n%d", i), OS: OSLinux,
+			Connection: &Connection{Host: fmt.Sprintf("10.0.0.%d", i), Port: "22", User: "root", SSHKey: "/tmp/id_rsa"}}))
+	}
+	if err := o.RegistrateNodes(nodes...); err != nil {
+		t.Fatal(err)
+	}
+	info := &ServiceInfo{ServiceName: "s", TimeoutSeconds: 1, Aggregation: Aggregation{Policy: AggregationAtLeast, Nodes: 2}}
+	if err := o.RegistrateServices(NewService(info, nodes...)); err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Now().Add(-time.Minute)
+	status := func(seconds int, state ServiceState, active int) *ServiceStatusInfo {
+		s := &ServiceStatusInfo{ServiceStatus: state, ThisUpdate: t0.Add(time.Duration(seconds) * time.Second)}
+		for i, node := range nodes {
+			n := &NodeStatusInfo{NodeName: node.NodeName, ServiceStatus: ServiceStateInactive}
+			if i < active {
+				n.ServiceStatus = ServiceStateActive
+			}
+			s.NodeStatus = append(s.NodeStatus, n)
+		}
+		return s
+	}
+	statuses := []*ServiceStatusInfo{
+		status(0, ServiceStateActive, 3),
+		status(10, ServiceStateDegraded, 2), // policy is satisfied -- up
+		status(20, ServiceStateInactive, 0),
+		status(30, ServiceStateDegraded, 1), // policy is not satisfied -- still down
+		status(40, ServiceStateActive, 3),
+	}
+	prev := &ServiceStatusInfo{ServiceStatus: ServiceStateInitialized}
+	o.mu.Lock()
+	for _, cur := range statuses {
+		o.recordHistory("s", prev, cur)
+		prev = cur
+	}
+	o.mu.Unlock()
+	history, err := o.History("s", time.Time{}, t0.Add(50*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := history.Uptime
+	if report.Failures != 1 || report.Recoveries != 1 {
+		t.Errorf("%d failures and %d recoveries, expected 1 and 1", report.Failures, report.Recoveries)
+	}
+	if report.UptimeSeconds != 30 || report.MTTRSeconds != 20 {
+		t.Errorf("%v seconds is up with MTTR %v seconds, expected 30 and 20", report.UptimeSeconds, report.MTTRSeconds)
+	}
+}
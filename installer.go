@@ -40,6 +40,28 @@ func InstallDebianService(servicePath string, connection *Connection, passPhrase
 	return nil
 }
 
+// InstallPackage installs debian package from orchestrator's host on node
+func (o *Orchestrator) InstallPackage(nodeName, packagePath, passPhrase string) error {
+	node, err := o.GetNode(nodeName)
+	if err != nil {
+		return err
+	}
+	if node.OS != OSLinux {
+		return o.Errorf("package can't be installed on '%s' node with '%s' OS", nodeName, node.OS)
+	}
+	if node.Connection == nil { // LOCAL
+		_, err = o.RunCommand(nodeName, fmt.Sprintf(LinuxInstallingDebFormatString, packagePath))
+	} else {
+		err = InstallDebianService(packagePath, node.Connection, passPhrase)
+	}
+	if err != nil {
+		o.logf(ERROR, "'%s' package has not been installed on '%s' node. Error message: %s", packagePath, nodeName, err.Error())
+		return err
+	}
+	o.logf(WARNING, "'%s' package has been installed on '%s' node", packagePath, nodeName)
+	return nil
+}
+
 func SetFileUnix(file *os.File, connection *Connection, path string, passPhrase string) error {
 	if err := connection.Valid(); err != nil {
 		return err
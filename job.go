@@ -0,0 +1,158 @@
+package orchestrator
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// JOB STATES
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is a long-running operation over service's nodes
+type Job struct {
+	ID       string
+	Type     string
+	Service  string
+	State    string // running / succeeded / failed / cancelled
+	Steps    []*JobStep
+	Error    string `json:",omitempty"`
+	Started  time.Time
+	Finished time.Time
+	cancel   context.CancelFunc
+}
+
+// JobStep is a completed action of job on node
+type JobStep struct {
+	Node   string
+	Action string
+	Time   time.Time
+	Error  string `json:",omitempty"`
+}
+
+func (j *Job) copy() *Job {
+	cp := *j
+	cp.Steps = make([]*JobStep, len(j.Steps))
+	for i, step := range j.Steps {
+		s := *step
+		cp.Steps[i] = &s
+	}
+	cp.cancel = nil
+	return &cp
+}
+
+// runJob starts job in background, run's error fails the job
+func (o *Orchestrator) runJob(jobType, serviceName string, run func(ctx context.Context, job *Job) error) *Job {
+	ctx, cancel := context.WithCancel(o.ctx)
+	o.mu.Lock()
+	o.jobID++
+	job := &Job{
+		ID:      strconv.FormatUint(o.jobID, 10),
+		Type:    jobType,
+		Service: serviceName,
+		State:   JobRunning,
+		Steps:   []*JobStep{},
+		Started: time.Now(),
+		cancel:  cancel,
+	}
+	o.job[job.ID] = job
+	o.pruneJobs()
+	cp := job.copy()
+	o.mu.Unlock()
+	o.logf(INFO, "'%s' job #%s of '%s' service has been started", jobType, job.ID, serviceName)
+	started := o.spawn(func() {
+		err := run(ctx, job)
+		o.mu.Lock()
+		job.Finished = time.Now()
+		switch {
+		case ctx.Err() != nil:
+			job.State = JobCancelled
+		case err != nil:
+			job.State, job.Error = JobFailed, err.Error()
+		default:
+			job.State = JobSucceeded
+		}
+		state := job.State
+		o.mu.Unlock()
+		cancel()
+		o.publish(Event{Type: EventJobFinished, Service: serviceName, Error: err})
+		o.logf(INFO, "'%s' job #%s of '%s' service has been %s", jobType, job.ID, serviceName, state)
+	})
+	if !started {
+		cancel()
+		o.mu.Lock()
+		job.State, job.Finished = JobCancelled, time.Now()
+		cp = job.copy()
+		o.mu.Unlock()
+	}
+	return cp
+}
+
+// step records action of job on node
+func (o *Orchestrator) step(job *Job, nodeName, action string, err error) {
+	step := &JobStep{Node: nodeName, Action: action, Time: time.Now()}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	o.mu.Lock()
+	job.Steps = append(job.Steps, step)
+	o.mu.Unlock()
+}
+
+// pruneJobs removes the oldest finished jobs over history limit, must be called under lock
+func (o *Orchestrator) pruneJobs() {
+	for len(o.job) > o.hLimit {
+		var oldest *Job
+		for _, job := range o.job {
+			if job.State != JobRunning && (oldest == nil || job.Started.Before(oldest.Started)) {
+				oldest = job
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		delete(o.job, oldest.ID)
+	}
+}
+
+func (o *Orchestrator) Jobs() []*Job {
+	o.mu.RLock()
+	jobs := []*Job{}
+	for _, job := range o.job {
+		jobs = append(jobs, job.copy())
+	}
+	o.mu.RUnlock()
+	return jobs
+}
+
+func (o *Orchestrator) GetJob(id string) (*Job, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if job, exist := o.job[id]; exist {
+		return job.copy(), nil
+	}
+	return nil, o.Errorf("'%s' job is not exist", id)
+}
+
+// CancelJob stops running job after its current step
+func (o *Orchestrator) CancelJob(id string) error {
+	o.mu.Lock()
+	job, exist := o.job[id]
+	if !exist {
+		o.mu.Unlock()
+		return o.Errorf("'%s' job is not exist", id)
+	}
+	if job.State != JobRunning {
+		o.mu.Unlock()
+		return o.Errorf("'%s' job is already %s", id, job.State)
+	}
+	cancel := job.cancel
+	o.mu.Unlock()
+	cancel()
+	return nil
+}
@@ -0,0 +1,112 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+)
+
+// Stop cancels all routines and waits until they have exited
+func (o *Orchestrator) Stop() error {
+	return o.Shutdown(context.Background())
+}
+
+// Shutdown cancels status routines, jobs and delivery routines, handles pending statuses,
+// closes subscribers, SSH connections and storage, returns when everything has exited
+// or ctx is done, connections and storage are closed in both cases.
+// Orchestrator can't be started again after shutdown
+func (o *Orchestrator) Shutdown(ctx context.Context) error {
+	o.mu.Lock()
+	o.cancel() // under lock, so no routine is entered after cancellation
+	started := o.started
+	o.mu.Unlock()
+	exited := make(chan struct{})
+	go func() {
+		if started {
+			<-o.done
+		}
+		o.closeSubscribers() // webhook & notifier routines exit on closed subscription
+		o.wg.Wait()
+		close(exited)
+	}()
+	var err error
+	select {
+	case <-exited:
+	case <-ctx.Done():
+		err = o.Errorf("shutdown: %s", ctx.Err().Error())
+	}
+	o.mu.Lock()
+	for nodeName, client := range o.client {
+		client.Close()
+		delete(o.client, nodeName)
+	}
+	storage := o.storage
+	o.storage = nil // routines which have not exited yet don't persist anymore
+	o.mu.Unlock()
+	if storage != nil {
+		if closeErr := storage.Close(); closeErr != nil {
+			if err != nil {
+				return o.Errorf("shutdown: %s; storage: %s", ctx.Err().Error(), closeErr.Error())
+			}
+			return o.Errorf("shutdown: %s", closeErr.Error())
+		}
+	}
+	if err != nil {
+		return err
+	}
+	o.logf(INFO, "orchestrator has been stopped")
+	return nil
+}
+
+// enter registers routine which must exit before shutdown,
+// returns false if orchestrator is stopping, must be called without lock
+func (o *Orchestrator) enter() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.ctx.Err() != nil {
+		return false
+	}
+	o.wg.Add(1)
+	return true
+}
+
+// spawn runs f in goroutine registered by enter
+func (o *Orchestrator) spawn(f func()) bool {
+	if !o.enter() {
+		return false
+	}
+	go func() {
+		defer o.wg.Done()
+		f()
+	}()
+	return true
+}
+
+// send passes event of status routine to Start, event is dropped if orchestrator is stopping
+func (o *Orchestrator) send(e Event) {
+	select {
+	case o.ch <- e:
+	case <-o.ctx.Done():
+	}
+}
+
+func (o *Orchestrator) closeSubscribers() {
+	o.mu.Lock()
+	for id, sub := range o.subscriber {
+		delete(o.subscriber, id)
+		close(sub.ch)
+	}
+	o.mu.Unlock()
+}
+
+// Shutdown stops orchestrator, which closes event streams, and then HTTP server,
+// HTTP server is shut down even if orchestrator has not been stopped in time
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.Orchestrator.Shutdown(ctx)
+	if echoErr := s.Echo.Shutdown(ctx); echoErr != nil {
+		if err != nil {
+			return fmt.Errorf("%s; HTTP server: %s", err.Error(), echoErr.Error())
+		}
+		return echoErr
+	}
+	return err
+}
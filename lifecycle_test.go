@@ -0,0 +1,87 @@
+package orchestrator
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// closingStorage records whether storage is closed
+type closingStorage struct {
+	Storage
+	closed chan struct{}
+}
+
+func (s *closingStorage) Load() (*StorageState, error) { return &StorageState{}, nil }
+
+func (s *closingStorage) SaveEvent(event *EventRecord) error { return nil }
+
+func (s *closingStorage) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestShutdown(t *testing.T) {
+	o := NewOrchestrator()
+	storage := &closingStorage{closed: make(chan struct{})}
+	if err := o.SetStorage(storage); err != nil {
+		t.Fatal(err)
+	}
+	go o.Start(context.Background())
+	if err := o.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-storage.closed:
+	default:
+		t.Error("storage is not closed")
+	}
+}
+
+func TestShutdownTimeoutClosesStorage(t *testing.T) {
+	o := NewOrchestrator()
+	storage := &closingStorage{closed: make(chan struct{})}
+	if err := o.SetStorage(storage); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	o.spawn(func() { <-release }) // routine which doesn't exit in time
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := o.Shutdown(ctx); err == nil {
+		t.Error("shutdown is not timed out")
+	}
+	select {
+	case <-storage.closed:
+	default:
+		t.Error("storage is not closed after shutdown timeout")
+	}
+}
+
+func TestStartFails(t *testing.T) {
+	o := NewOrchestrator()
+	exited := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { exited <- o.Start(ctx) }()
+	for started := false; !started; time.Sleep(time.Millisecond) {
+		o.mu.RLock()
+		started = o.started
+		o.mu.RUnlock()
+	}
+	if err := o.Start(context.Background()); err == nil {
+		t.Error("orchestrator is started twice")
+	}
+	cancel()
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Errorf("start: %s", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("start has not returned after ctx is done")
+	}
+	if err := o.Start(context.Background()); err == nil {
+		t.Error("orchestrator is started after shutdown")
+	}
+}
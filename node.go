@@ -13,7 +13,7 @@ import (
 )
 
 type Node struct {
-	NodeStatus int
+	NodeStatus NodeState
 	NodeInfo
 }
 
@@ -34,10 +34,20 @@ func NewNode(config *NodeInfo) *Node {
 	return &Node{StatusInitialized, *config}
 }
 
-func (n *Node) Status() int {
+func (n *Node) Status() NodeState {
 	return n.NodeStatus
 }
 
+// copy returns deep copy of node
+func (n *Node) copy() *Node {
+	cp := *n
+	if n.Connection != nil {
+		connection := *n.Connection
+		cp.Connection = &connection
+	}
+	return &cp
+}
+
 func (n *Node) Connect(passPhrase string) (*ssh.Client, error) {
 	if n.Connection == nil {
 		return nil, fmt.Errorf("Node access: '%s' node is configured as local", n.NodeName)
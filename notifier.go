@@ -0,0 +1,365 @@
+package orchestrator
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ALERT SEVERITIES
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Alert is a notification about firing or resolved problem
+type Alert struct {
+	Key      string // de-duplication key
+	Rule     string
+	Severity string
+	Service  string
+	Node     string
+	Status   ServiceState
+	Resolved bool
+	Message  string
+	Time     time.Time
+}
+
+// DefaultNotifierTimeoutSeconds is a timeout of notification if it is not set
+const DefaultNotifierTimeoutSeconds = 10
+
+// Notifier delivers group of alerts
+type Notifier interface {
+	Name() string
+	Notify(alerts []*Alert) error
+}
+
+// NotifyPolicy sets how alerts are delivered by notifier
+type NotifyPolicy struct {
+	Services              []string // all services if empty
+	GroupWaitSeconds      int      // alerts are collected and sent as a group every GroupWaitSeconds
+	RateLimitSeconds      int      // minimum interval between notifications about the same service
+	RepeatIntervalSeconds int      // firing alert is repeated after this interval, 0 -- never
+}
+
+type notifierRoutine struct {
+	notifier Notifier
+	policy   NotifyPolicy
+	alerts   chan *Alert // alerts of rules
+	cancel   func()
+}
+
+func (a *Alert) String() string {
+	state := "FIRING"
+	if a.Resolved {
+		state = "RESOLVED"
+	}
+	return fmt.Sprintf("[%s] [%s] %s", state, a.Severity, a.Message)
+}
+
+// statusAlert converts service's status-changed event into alert,
+// returns nil if status is not known yet
+func statusAlert(e *Event) *Alert {
+	if e.Node != "" || !isKnown(e.To) {
+		return nil
+	}
+	alert := &Alert{
+		Key:      "status/" + e.Service,
+		Rule:     "status",
+		Severity: SeverityCritical,
+		Service:  e.Service,
+		Status:   e.To,
+		Resolved: e.To == ServiceStateActive,
+		Time:     e.Time,
+	}
+	if e.To == ServiceStateDegraded {
+		alert.Severity = SeverityWarning
+	}
+	if alert.Resolved {
+		alert.Severity = SeverityInfo
+	}
+	alert.Message = fmt.Sprintf("'%s' service is %s", e.Service, e.To)
+	return alert
+}
+
+func formatAlerts(alerts []*Alert) (subject string, text string) {
+	firing := 0
+	lines := []string{}
+	for _, alert := range alerts {
+		if !alert.Resolved {
+			firing++
+		}
+		lines = append(lines, alert.String())
+	}
+	subject = fmt.Sprintf("Orchestrator: %d firing, %d resolved", firing, len(alerts)-firing)
+	if len(alerts) == 1 {
+		subject = "Orchestrator: " + alerts[0].String()
+	}
+	return subject, strings.Join(lines, "\n")
+}
+
+// SMTPNotifier sends alerts by email
+type SMTPNotifier struct {
+	NotifierName   string
+	Host           string
+	Port           string
+	User           string // plain auth is used if User is set
+	Password       string
+	From           string
+	To             []string
+	TimeoutSeconds int // timeout of SMTP session, DefaultNotifierTimeoutSeconds if 0
+}
+
+func (n *SMTPNotifier) Name() string { return n.NotifierName }
+
+func (n *SMTPNotifier) Valid() error {
+	if n.NotifierName == "" {
+		return errors.New("SMTP notifier validation: undefined name")
+	}
+	if n.Host == "" || n.From == "" || len(n.To) < 1 {
+		return errors.New("SMTP notifier validation: host, from and to must be defined")
+	}
+	if n.Port == "" {
+		n.Port = "25"
+	}
+	if n.TimeoutSeconds < 0 {
+		return errors.New("SMTP notifier validation: timeout must not be negative")
+	}
+	return nil
+}
+
+func (n *SMTPNotifier) Notify(alerts []*Alert) error {
+	subject, text := formatAlerts(alerts)
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		n.From, strings.Join(n.To, ", "), subject, strings.ReplaceAll(text, "\n", "\r\n"))
+	if err := n.send([]byte(message)); err != nil {
+		return fmt.Errorf("SMTP notifier: %s", err.Error())
+	}
+	return nil
+}
+
+// send is like smtp.SendMail, but the whole session has a deadline
+func (n *SMTPNotifier) send(message []byte) error {
+	timeout := notifierTimeout(n.TimeoutSeconds)
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(n.Host, n.Port), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return err
+		}
+	}
+	if ok, _ := client.Extension("AUTH"); ok && n.User != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.User, n.Password, n.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.From); err != nil {
+		return err
+	}
+	for _, to := range n.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func notifierTimeout(seconds int) time.Duration {
+	if seconds < 1 {
+		seconds = DefaultNotifierTimeoutSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// ChatNotifier sends alerts into Slack/Mattermost-compatible incoming webhook
+type ChatNotifier struct {
+	NotifierName   string
+	URL            string
+	Channel        string
+	Username       string
+	TimeoutSeconds int // request timeout, DefaultNotifierTimeoutSeconds if 0
+}
+
+func (n *ChatNotifier) Name() string { return n.NotifierName }
+
+func (n *ChatNotifier) Valid() error {
+	if n.NotifierName == "" {
+		return errors.New("Chat notifier validation: undefined name")
+	}
+	if _, err := url.ParseRequestURI(n.URL); err != nil {
+		return errors.New("Chat notifier validation: can't parse url")
+	}
+	if n.TimeoutSeconds < 0 {
+		return errors.New("Chat notifier validation: timeout must not be negative")
+	}
+	return nil
+}
+
+func (n *ChatNotifier) Notify(alerts []*Alert) error {
+	subject, text := formatAlerts(alerts)
+	payload := map[string]string{"text": text}
+	if len(alerts) > 1 {
+		payload["text"] = "*" + subject + "*\n" + text
+	}
+	if n.Channel != "" {
+		payload["channel"] = n.Channel
+	}
+	if n.Username != "" {
+		payload["username"] = n.Username
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("Chat notifier: %s", err.Error())
+	}
+	client := &http.Client{Timeout: notifierTimeout(n.TimeoutSeconds)}
+	resp, err := client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Chat notifier: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Chat notifier: unexpected status '%d'", resp.StatusCode)
+	}
+	return nil
+}
+
+func (p *NotifyPolicy) Valid() error {
+	if p.GroupWaitSeconds < 0 || p.RateLimitSeconds < 0 || p.RepeatIntervalSeconds < 0 {
+		return errors.New("Notify policy validation: intervals must not be negative")
+	}
+	return nil
+}
+
+// AddNotifier starts notifier's routine driven by service status changes and alert rules
+func (o *Orchestrator) AddNotifier(notifier Notifier, policy NotifyPolicy) error {
+	if v, ok := notifier.(interface{ Valid() error }); ok {
+		if err := v.Valid(); err != nil {
+			return err
+		}
+	}
+	if err := policy.Valid(); err != nil {
+		return err
+	}
+	policy.Services = append([]string(nil), policy.Services...)
+	o.mu.Lock()
+	if _, exist := o.notifier[notifier.Name()]; exist {
+		o.mu.Unlock()
+		return o.Errorf("'%s' notifier already exist", notifier.Name())
+	}
+	routine := &notifierRoutine{notifier, policy, make(chan *Alert, DefaultSubscriberBuffer), nil}
+	o.notifier[notifier.Name()] = routine
+	o.mu.Unlock()
+	events, cancel := o.Subscribe(&EventFilter{Services: policy.Services, Types: []string{EventStatusChanged}})
+	routine.cancel = cancel
+	o.spawn(func() { o.notifierRoutine(routine, events) })
+	o.logf(INFO, "'%s' notifier has been added", notifier.Name())
+	return nil
+}
+
+func (o *Orchestrator) RemoveNotifier(name string) error {
+	o.mu.Lock()
+	routine, exist := o.notifier[name]
+	if !exist {
+		o.mu.Unlock()
+		return o.Errorf("'%s' notifier is not exist", name)
+	}
+	delete(o.notifier, name)
+	o.mu.Unlock()
+	routine.cancel()
+	o.logf(INFO, "'%s' notifier has been deleted", name)
+	return nil
+}
+
+// notifierRoutine groups, de-duplicates and rate-limits alerts
+func (o *Orchestrator) notifierRoutine(routine *notifierRoutine, events <-chan Event) {
+	wait := time.Duration(routine.policy.GroupWaitSeconds) * time.Second
+	if wait < time.Second {
+		wait = time.Second
+	}
+	rateLimit := time.Duration(routine.policy.RateLimitSeconds) * time.Second
+	repeat := time.Duration(routine.policy.RepeatIntervalSeconds) * time.Second
+	pending := make(map[string]*Alert) // the latest alert by key
+	sent := make(map[string]*Alert)    // the latest sent alert by key
+	lastSent := make(map[string]time.Time)
+	serviceSent := make(map[string]time.Time)
+	ticker := time.NewTicker(wait)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if alert := statusAlert(&e); alert != nil && (alert.Resolved || !o.Suppressed(alert)) {
+				pending[alert.Key] = alert
+			}
+		case alert := <-routine.alerts:
+			pending[alert.Key] = alert
+		case now := <-ticker.C:
+			for key, alert := range sent { // repeat firing alerts
+				if _, exist := pending[key]; !exist && !alert.Resolved && repeat > 0 && now.Sub(lastSent[key]) >= repeat {
+					pending[key] = alert
+				}
+			}
+			group := []*Alert{}
+			grouped := make(map[string]bool) // services of group
+			for key, alert := range pending {
+				last, wasSent := sent[key]
+				if (!wasSent && alert.Resolved) || (wasSent && last.Resolved == alert.Resolved && last.Status == alert.Status &&
+					last.Severity == alert.Severity && (repeat < 1 || now.Sub(lastSent[key]) < repeat)) { // duplicate
+					delete(pending, key)
+					continue
+				}
+				if !grouped[alert.Service] && now.Sub(serviceSent[alert.Service]) < rateLimit {
+					continue // stays pending
+				}
+				grouped[alert.Service] = true
+				group = append(group, alert)
+			}
+			if len(group) < 1 {
+				continue
+			}
+			if err := routine.notifier.Notify(group); err != nil { // alerts stay pending and are sent again
+				o.logf(ERROR, "'%s' notifier error: %s", routine.notifier.Name(), err.Error())
+				continue
+			}
+			for _, alert := range group {
+				sent[alert.Key] = alert
+				lastSent[alert.Key] = now
+				serviceSent[alert.Service] = now
+				delete(pending, alert.Key)
+			}
+			o.logf(DEBUG, "'%s' notifier has sent %d alerts", routine.notifier.Name(), len(group))
+		}
+	}
+}
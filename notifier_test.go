@@ -0,0 +1,220 @@
+package orchestrator
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyNotifier fails first notifications
+type flakyNotifier struct {
+	mu       sync.Mutex
+	failures int
+	sent     [][]*Alert
+}
+
+func (n *flakyNotifier) Name() string { return "flaky" }
+
+func (n *flakyNotifier) Notify(alerts []*Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.failures > 0 {
+		n.failures--
+		return errors.New("not delivered")
+	}
+	n.sent = append(n.sent, alerts)
+	return nil
+}
+
+func (n *flakyNotifier) notifications() [][]*Alert {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([][]*Alert{}, n.sent...)
+}
+
+func TestNotifierRetriesFailedAlerts(t *testing.T) {
+	o := NewOrchestrator()
+	defer o.Stop()
+	notifier := &flakyNotifier{failures: 1}
+	if err := o.AddNotifier(notifier, NotifyPolicy{RateLimitSeconds: 60}); err != nil {
+		t.Fatal(err)
+	}
+	o.publish(Event{Type: EventStatusChanged, Service: "a", From: ServiceStateActive, To: ServiceStateInactive})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(notifier.notifications()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	sent := notifier.notifications()
+	if len(sent) != 1 || len(sent[0]) != 1 {
+		t.Fatalf("alert is not sent after failed notification: %v", sent)
+	}
+	if alert := sent[0][0]; alert.Service != "a" || alert.Resolved || alert.Status != ServiceStateInactive {
+		t.Errorf("unexpected alert: %s", alert)
+	}
+}
+
+// waitNotifications waits until notifier has sent n groups of alerts
+func waitNotifications(t *testing.T, notifier *flakyNotifier, n int) [][]*Alert {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(notifier.notifications()) < n && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	sent := notifier.notifications()
+	if len(sent) < n {
+		t.Fatalf("%d notifications, expected %d", len(sent), n)
+	}
+	return sent
+}
+
+func TestNotifierGroupsAndDeduplicates(t *testing.T) {
+	o := NewOrchestrator()
+	defer o.Stop()
+	notifier := &flakyNotifier{}
+	if err := o.AddNotifier(notifier, NotifyPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.AddNotifier(&flakyNotifier{}, NotifyPolicy{}); err == nil {
+		t.Error("notifier with the same name is added")
+	}
+	o.publish(Event{Type: EventStatusChanged, Service: "a", From: ServiceStateActive, To: ServiceStateInactive})
+	o.publish(Event{Type: EventStatusChanged, Service: "b", From: ServiceStateActive, To: ServiceStateDegraded})
+	o.publish(Event{Type: EventStatusChanged, Service: "c", From: ServiceStateInactive, To: ServiceStateActive}) // resolved, never fired
+	sent := waitNotifications(t, notifier, 1)
+	if len(sent[0]) != 2 {
+		t.Fatalf("%d alerts in group, expected 2", len(sent[0]))
+	}
+	for _, alert := range sent[0] {
+		if expected := map[string]string{"a": SeverityCritical, "b": SeverityWarning}[alert.Service]; alert.Severity != expected {
+			t.Errorf("'%s' service alert severity is %s, expected %s", alert.Service, alert.Severity, expected)
+		}
+	}
+	o.publish(Event{Type: EventStatusChanged, Service: "a", From: ServiceStateUnreachable, To: ServiceStateInactive}) // duplicate
+	o.publish(Event{Type: EventStatusChanged, Service: "b", From: ServiceStateDegraded, To: ServiceStateActive})
+	sent = waitNotifications(t, notifier, 2)
+	if len(sent[1]) != 1 || sent[1][0].Service != "b" || !sent[1][0].Resolved {
+		t.Errorf("unexpected second notification: %v", sent[1])
+	}
+	if err := o.RemoveNotifier("flaky"); err != nil {
+		t.Error(err)
+	}
+	if err := o.RemoveNotifier("flaky"); err == nil {
+		t.Error("removed notifier is removed again")
+	}
+}
+
+func TestChatNotifier(t *testing.T) {
+	payloads := make(chan map[string]string, 1)
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads <- payload
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	notifier := &ChatNotifier{NotifierName: "chat", URL: server.URL, Channel: "#ops", Username: "orchestrator"}
+	if err := notifier.Valid(); err != nil {
+		t.Fatal(err)
+	}
+	alerts := []*Alert{
+		{Severity: SeverityCritical, Message: "'a' service is inactive"},
+		{Severity: SeverityInfo, Message: "'b' service is active", Resolved: true},
+	}
+	if err := notifier.Notify(alerts); err != nil {
+		t.Fatal(err)
+	}
+	payload := <-payloads
+	if payload["channel"] != "#ops" || payload["username"] != "orchestrator" {
+		t.Errorf("unexpected channel or username: %v", payload)
+	}
+	expected := "*Orchestrator: 1 firing, 1 resolved*\n[FIRING] [critical] 'a' service is inactive\n[RESOLVED] [info] 'b' service is active"
+	if payload["text"] != expected {
+		t.Errorf("text is %q, expected %q", payload["text"], expected)
+	}
+	status = http.StatusInternalServerError
+	if err := notifier.Notify(alerts[:1]); err == nil {
+		t.Error("failed notification has no error")
+	}
+	<-payloads
+}
+
+// serveSMTP accepts one SMTP session and returns its message
+func serveSMTP(listener net.Listener) <-chan string {
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		message := []string{}
+		data := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch {
+			case data && line == ".":
+				data = false
+				messages <- strings.Join(message, "\n")
+				reply("250 OK")
+			case data:
+				message = append(message, line)
+			case strings.HasPrefix(line, "EHLO"), strings.HasPrefix(line, "HELO"):
+				reply("250 localhost")
+			case line == "DATA":
+				data = true
+				reply("354 go ahead")
+			case line == "QUIT":
+				reply("221 bye")
+				return
+			default: // MAIL, RCPT
+				reply("250 OK")
+			}
+		}
+	}()
+	return messages
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	messages := serveSMTP(listener)
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	notifier := &SMTPNotifier{NotifierName: "mail", Host: host, Port: port, From: "orchestrator@example.com",
+		To: []string{"ops@example.com", "dev@example.com"}, TimeoutSeconds: 5}
+	if err := notifier.Valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Notify([]*Alert{{Severity: SeverityCritical, Message: "'a' service is inactive"}}); err != nil {
+		t.Fatal(err)
+	}
+	message := <-messages
+	for _, header := range []string{
+		"To: ops@example.com, dev@example.com",
+		"Subject: Orchestrator: [FIRING] [critical] 'a' service is inactive",
+	} {
+		if !strings.Contains(message, header) {
+			t.Errorf("message has no %q:\n%s", header, message)
+		}
+	}
+	if err := (&SMTPNotifier{NotifierName: "mail", Host: host}).Valid(); err == nil {
+		t.Error("notifier without recipients is valid")
+	}
+}
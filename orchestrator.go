@@ -1,106 +1,173 @@
 package orchestrator
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"os/exec"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
-var (
-	ServiceName string = "orchestrator"
-	fMux        sync.Mutex
-)
+// ServiceName is a service name of orchestrator.
+//
+// Deprecated: it is not used by orchestrator, use OrchestratorServiceType.
+var ServiceName string = OrchestratorServiceType
 
 type Orchestrator struct {
-	logLevel int
+	mu       sync.RWMutex // protects all fields below except logLevel
+	logLevel int32        // atomic
 	ch       chan Event
 	node     map[string]*Node
 	service  map[string]*Service
-	client   map[string]*ssh.Client // node's client
-	status   map[string]bool
-}
-
-type Event struct {
-	Service string
-	Status  ServiceStatusInfo
-	Error   error
+	client   map[string]*ssh.Client    // node's client
+	routine  map[string]*statusRoutine // status routine by service
+	check    map[string]*checkState    // service's check thresholds & flap state
+	history  map[string]*statusHistory // transitions of services & their nodes
+	hLimit   int                       // history limit per service & per node
+	storage  Storage
+	// event subscribers
+	subscriber map[uint64]*subscriber
+	subID      uint64
+	eventID    uint64
+	recent     []Event // recent events for resuming subscribers
+	webhook    map[string]*webhookRoutine
+	deadLetter []*DeadLetter
+	notifier   map[string]*notifierRoutine
+	// alerting
+	rule        map[string]*AlertRule
+	ruleState   map[string]*ruleState // by rule & service
+	silence     map[string]*Silence
+	silenceID   uint64
+	maintenance map[string]*MaintenanceWindow
+	remediation map[string]*remediationState // by service & node
+	// reconciler
+	dryRun      bool
+	drifted     map[string]*driftState // by service & node
+	reconciling map[string]bool        // by service
+	// jobs
+	job   map[string]*Job
+	jobID uint64
+	// probing
+	workers    chan struct{}           // global probe worker pool
+	nodeProbes int                     // status commands at once per node
+	prober     map[string]*nodeProber  // by node
+	backoff    map[string]*nodeBackoff // by service & node
+	// configuration
+	configPath string     // file loaded by LoadConfig
+	logPinned  bool       // log level is set by OverrideLogLevel, config doesn't change it
+	reload     sync.Mutex // serializes reloads of configuration
+	// lifecycle
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup // routines which must exit before shutdown
+	started bool
+	done    chan struct{} // closed when Start has returned
 }
 
 func NewOrchestrator() *Orchestrator {
-	return &Orchestrator{ERROR, make(chan Event, 100), make(map[string]*Node), make(map[string]*Service), make(map[string]*ssh.Client), make(map[string]bool)}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Orchestrator{
+		logLevel:    ERROR,
+		ch:          make(chan Event, 100),
+		node:        make(map[string]*Node),
+		service:     make(map[string]*Service),
+		client:      make(map[string]*ssh.Client),
+		routine:     make(map[string]*statusRoutine),
+		check:       make(map[string]*checkState),
+		history:     make(map[string]*statusHistory),
+		hLimit:      DefaultHistoryLimit,
+		subscriber:  make(map[uint64]*subscriber),
+		recent:      []Event{},
+		webhook:     make(map[string]*webhookRoutine),
+		deadLetter:  []*DeadLetter{},
+		notifier:    make(map[string]*notifierRoutine),
+		rule:        make(map[string]*AlertRule),
+		ruleState:   make(map[string]*ruleState),
+		silence:     make(map[string]*Silence),
+		maintenance: make(map[string]*MaintenanceWindow),
+		remediation: make(map[string]*remediationState),
+		drifted:     make(map[string]*driftState),
+		reconciling: make(map[string]bool),
+		job:         make(map[string]*Job),
+		workers:     make(chan struct{}, DefaultProbeWorkers),
+		nodeProbes:  DefaultNodeProbes,
+		prober:      make(map[string]*nodeProber),
+		backoff:     make(map[string]*nodeBackoff),
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
 }
 
 func (o *Orchestrator) GetNode(name string) (*Node, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
 	if node, exist := o.node[name]; exist {
-		n := *node // copy
-		return &n, nil
+		return node.copy(), nil
 	}
 	return nil, o.Errorf("'%s' node is not exist", name)
 }
 
 func (o *Orchestrator) GetService(name string) (*Service, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
 	if service, exist := o.service[name]; exist {
-		s := *service // copy
-		return &s, nil
+		return service.copy(), nil
 	}
 	return nil, o.Errorf("'%s' service is not exist", name)
 }
 
 func (o *Orchestrator) copyNodesAsArray() []*Node {
-	fMux.Lock()
+	o.mu.RLock()
 	nodes := []*Node{}
 	for _, node := range o.node {
 		if node != nil {
-			cp := *node
-			nodes = append(nodes, &cp)
+			nodes = append(nodes, node.copy())
 		}
 	}
-	fMux.Unlock()
+	o.mu.RUnlock()
 	return nodes
 }
 
 func (o *Orchestrator) copyNodesAsMap() map[string]*Node {
-	fMux.Lock()
+	o.mu.RLock()
 	nodes := map[string]*Node{}
 	for _, node := range o.node {
 		if node != nil {
-			cp := *node
-			nodes[cp.NodeName] = &cp
+			nodes[node.NodeName] = node.copy()
 		}
 	}
-	fMux.Unlock()
+	o.mu.RUnlock()
 	return nodes
 }
 
 func (o *Orchestrator) copyServicesAsArray() []*Service {
-	fMux.Lock()
+	o.mu.RLock()
 	services := []*Service{}
 	for _, srv := range o.service {
 		if srv != nil {
-			cp := *srv
-			services = append(services, &cp)
+			services = append(services, srv.copy())
 		}
 	}
-	fMux.Unlock()
+	o.mu.RUnlock()
 	return services
 }
 
 func (o *Orchestrator) copyServicesAsMap() map[string]*Service {
-	fMux.Lock()
+	o.mu.RLock()
 	services := map[string]*Service{}
 	for _, srv := range o.service {
 		if srv != nil {
-			cp := *srv
-			services[cp.ServiceName] = &cp
+			services[srv.ServiceName] = srv.copy()
 		}
 	}
-	fMux.Unlock()
+	o.mu.RUnlock()
 	return services
 }
 
@@ -109,206 +176,487 @@ func (o *Orchestrator) RegistrateNodes(nodes ...*Node) error {
 		if err := node.Valid(); err != nil {
 			return err
 		}
-		if _, exist := o.node[node.NodeName]; exist {
-			return o.Errorf("'%s' node already exist", node.NodeName)
-		}
-		fMux.Lock()
-		for _, n := range o.node {
-			if n.Connection == nil && node.Connection == nil {
-				fMux.Unlock()
-				return o.Errorf("'%s' local node already exist", n.NodeName)
-			} else if n.Connection != nil && node.Connection != nil {
-				if n.Connection.Host == node.Connection.Host {
-					fMux.Unlock()
-					return o.Errorf("'%s' node already exist with same '%s' host", node.NodeName, node.Connection.Host)
-				}
+		o.mu.Lock()
+		if err := o.addNode(node); err != nil {
+			o.mu.Unlock()
+			return err
+		}
+		cp := node.copy()
+		o.mu.Unlock()
+		o.persist(func(s Storage) error { return s.SaveNode(cp) })
+	}
+	return nil
+}
+
+// addNode checks that node doesn't conflict with registered ones and adds it, must be called under lock
+func (o *Orchestrator) addNode(node *Node) error {
+	if _, exist := o.node[node.NodeName]; exist {
+		return o.Errorf("'%s' node already exist", node.NodeName)
+	}
+	for _, n := range o.node {
+		if n.Connection == nil && node.Connection == nil {
+			return o.Errorf("'%s' local node already exist", n.NodeName)
+		} else if n.Connection != nil && node.Connection != nil {
+			if n.Connection.Host == node.Connection.Host {
+				return o.Errorf("'%s' node already exist with same '%s' host", node.NodeName, node.Connection.Host)
 			}
 		}
-		o.node[node.NodeName] = node
-		fMux.Unlock()
 	}
+	o.node[node.NodeName] = node.copy()
 	return nil
 }
 
 func (o *Orchestrator) RegistrateServices(services ...*Service) error {
-	fMux.Lock()
+	o.mu.Lock()
+	saved, err := o.addServices(services...)
+	if err != nil {
+		o.mu.Unlock()
+		return err
+	}
+	started := o.started
+	o.mu.Unlock()
+	for _, service := range saved {
+		o.persist(func(s Storage) error { return s.SaveService(service) })
+		if started {
+			go o.ServiceStatusRoutine(service.ServiceName)
+		}
+	}
+	return nil
+}
+
+// addServices checks services and adds them all or none, returns copies of added services,
+// must be called under lock
+func (o *Orchestrator) addServices(services ...*Service) ([]*Service, error) {
+	saved := []*Service{}
+	batch := make(map[string]bool)
 	for _, service := range services {
-		if _, exist := o.service[service.ServiceName]; exist {
-			fMux.Unlock()
-			return o.Errorf("'%s' service already exist", service.ServiceName)
+		if _, exist := o.service[service.ServiceName]; exist || batch[service.ServiceName] {
+			return nil, o.Errorf("'%s' service already exist", service.ServiceName)
 		}
+		batch[service.ServiceName] = true
 		if err := service.Valid(); err != nil {
-			fMux.Unlock()
-			return err
+			return nil, err
 		}
-		nodes := make([]*Node, len(service.Nodes))
-		for i, node := range service.Nodes {
+		for _, node := range service.Nodes {
 			if _, exist := o.node[node.NodeName]; !exist {
-				fMux.Unlock()
-				return o.Errorf("'%s' node is not defined in orchestrator", node.NodeName)
+				return nil, o.Errorf("'%s' node is not defined in orchestrator", node.NodeName)
 			}
+		}
+	}
+	if err := o.validDependencies(services...); err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		nodes := make([]*Node, len(service.Nodes))
+		for i, node := range service.Nodes {
 			nodes[i] = o.node[node.NodeName]
 		}
-		o.service[service.ServiceName] = service
-		o.service[service.ServiceName].Nodes = nodes
+		registered := service.copy() // caller can't change registered service
+		registered.Nodes = nodes
+		o.service[service.ServiceName] = registered
+		saved = append(saved, registered.copy())
+	}
+	return saved, nil
+}
+
+// UpdateNode replaces settings of registered node, node is disconnected if its connection is changed
+func (o *Orchestrator) UpdateNode(info *NodeInfo) error {
+	node := NewNode(info).copy()
+	if err := node.Valid(); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	current, exist := o.node[node.NodeName]
+	if !exist {
+		o.mu.Unlock()
+		return o.Errorf("'%s' node is not exist", node.NodeName)
+	}
+	for _, n := range o.node {
+		if n.NodeName == node.NodeName {
+			continue
+		}
+		if n.Connection == nil && node.Connection == nil {
+			o.mu.Unlock()
+			return o.Errorf("'%s' local node already exist", n.NodeName)
+		} else if n.Connection != nil && node.Connection != nil && n.Connection.Host == node.Connection.Host {
+			o.mu.Unlock()
+			return o.Errorf("'%s' node already exist with same '%s' host", n.NodeName, node.Connection.Host)
+		}
+	}
+	prev, status := o.setNodeInfo(current, node)
+	cp := current.copy()
+	o.mu.Unlock()
+	o.publishNodeStatus(node.NodeName, prev, status)
+	o.persist(func(s Storage) error { return s.SaveNode(cp) })
+	o.logf(INFO, "'%s' node has been updated", node.NodeName)
+	return nil
+}
+
+// UpdateService replaces settings of registered service keeping its nodes, status and history
+func (o *Orchestrator) UpdateService(info *ServiceInfo) error {
+	o.mu.Lock()
+	current, exist := o.service[info.ServiceName]
+	if !exist {
+		o.mu.Unlock()
+		return o.Errorf("'%s' service is not exist", info.ServiceName)
+	}
+	service := current.copy()
+	service.ServiceInfo = info.copy()
+	if err := service.Valid(); err != nil {
+		o.mu.Unlock()
+		return err
 	}
-	fMux.Unlock()
+	if err := o.validDependencies(service); err != nil {
+		o.mu.Unlock()
+		return err
+	}
+	current.ServiceInfo = service.ServiceInfo
+	cp := current.copy()
+	o.mu.Unlock()
+	o.reschedule(info.ServiceName)
+	o.persist(func(s Storage) error { return s.SaveService(cp) })
+	o.logf(INFO, "'%s' service has been updated", info.ServiceName)
 	return nil
 }
 
+// setNodeInfo replaces settings of registered node by settings of node and returns previous and new
+// node status, node is disconnected if its connection is changed, must be called under lock
+func (o *Orchestrator) setNodeInfo(current, node *Node) (NodeState, NodeState) {
+	prev := current.NodeStatus
+	status := prev
+	if (current.Connection == nil) != (node.Connection == nil) ||
+		(current.Connection != nil && *current.Connection != *node.Connection) {
+		if client, exist := o.client[node.NodeName]; exist {
+			client.Close()
+			delete(o.client, node.NodeName)
+		}
+		status = StatusDisconnected
+		if node.Connection == nil {
+			status = StatusConnected
+		}
+	}
+	current.NodeInfo = node.NodeInfo // services refer to the same node
+	current.NodeStatus = status
+	return prev, status
+}
+
 func (o *Orchestrator) RemoveNodes(names ...string) error {
 	for _, name := range names {
-		if _, exist := o.node[name]; exist {
-			for _, service := range o.service {
-				for _, node := range service.Nodes {
-					if node.NodeName == name {
-						return o.Errorf("%s node already in use", name)
-					}
+		o.mu.Lock()
+		if _, exist := o.node[name]; !exist {
+			o.mu.Unlock()
+			return o.Errorf("'%s' node is not exist", name)
+		}
+		for _, service := range o.service {
+			for _, node := range service.Nodes {
+				if node.NodeName == name {
+					o.mu.Unlock()
+					return o.Errorf("%s node already in use", name)
 				}
 			}
-			fMux.Lock()
-			delete(o.node, name)
-			fMux.Unlock()
-			o.logf(INFO, "'%s' node has been deleted from orchestrator", name)
-		} else {
-			return o.Errorf("'%s' service is not exist", name)
 		}
+		delete(o.node, name)
+		if client, exist := o.client[name]; exist {
+			client.Close()
+			delete(o.client, name)
+		}
+		delete(o.prober, name)
+		o.mu.Unlock()
+		o.persist(func(s Storage) error { return s.DeleteNode(name) })
+		o.logf(INFO, "'%s' node has been deleted from orchestrator", name)
 	}
 	return nil
 }
 
 func (o *Orchestrator) RemoveService(names ...string) error {
 	for _, name := range names {
-		if _, exist := o.service[name]; exist {
-			fMux.Lock()
-			delete(o.service, name)
-			fMux.Unlock()
-			o.logf(INFO, "'%s' service has been deleted from orchestrator", name)
-		} else {
+		o.mu.Lock()
+		if _, exist := o.service[name]; !exist {
+			o.mu.Unlock()
 			return o.Errorf("'%s' service is not exist", name)
 		}
+		for _, dependent := range o.dependents(name) {
+			removed := false
+			for _, n := range names {
+				removed = removed || n == dependent
+			}
+			if !removed {
+				o.mu.Unlock()
+				return o.Errorf("'%s' service is a dependency of '%s' service", name, dependent)
+			}
+		}
+		o.rmService(name)
+		o.mu.Unlock()
+		o.rmCheckState(name)
+		o.rmBackoff(name)
+		o.persist(func(s Storage) error { return s.DeleteService(name) })
+		o.logf(INFO, "'%s' service has been deleted from orchestrator", name)
 	}
 	return nil
 }
 
-func (o *Orchestrator) Start() {
-	time.Sleep(time.Duration(1) * time.Second)
-	for _, srv := range o.service {
+// rmService deletes service with its status routine, history and remediation state,
+// must be called under lock
+func (o *Orchestrator) rmService(name string) {
+	delete(o.service, name)
+	o.stopStatusR(name)
+	delete(o.history, name)
+	for key := range o.remediation {
+		if strings.HasPrefix(key, name+"/") {
+			delete(o.remediation, key)
+		}
+	}
+}
+
+// Start runs status routines of registered services and handles their statuses
+// until ctx is done or orchestrator is stopped, pending statuses are handled before return.
+// Status routines of services registered after Start are run on registration.
+// Returns error at once if orchestrator is already started or stopped
+func (o *Orchestrator) Start(ctx context.Context) error {
+	o.mu.Lock()
+	if o.started {
+		o.mu.Unlock()
+		return o.Errorf("orchestrator is already started")
+	}
+	if o.ctx.Err() != nil {
+		o.mu.Unlock()
+		return o.Errorf("orchestrator is stopped and can't be started again")
+	}
+	o.started = true
+	o.mu.Unlock()
+	defer close(o.done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			o.Stop()
+		case <-o.ctx.Done():
+		}
+	}()
+	for _, srv := range o.copyServicesAsArray() {
 		go o.ServiceStatusRoutine(srv.ServiceName)
 	}
 	for {
-		e := <-o.ch
-		if _, ok := o.service[e.Service]; ok {
-			fMux.Lock()
-			o.service[e.Service].ServiceStatus = e.Status
-			fMux.Unlock()
-			if o.logLevel < INFO {
-				o.logf(DEBUG, "'%s' service has HTTP access status=%d", e.Service, e.Status.HTTPAccessStatus)
-				for _, nodeStatus := range e.Status.NodeStatus {
-					o.logf(DEBUG, "'%s' service has status=%d on '%s' node", e.Service, nodeStatus.ServiceStatus, nodeStatus.NodeName)
+		select {
+		case e := <-o.ch:
+			o.handle(e)
+		case <-o.ctx.Done():
+			for { // drains pending events
+				select {
+				case e := <-o.ch:
+					o.handle(e)
+				default:
+					return nil
 				}
 			}
-			o.logf(INFO, "'%s' service has status=%d", e.Service, e.Status.ServiceStatus)
 		}
 	}
 }
 
+// handle stores service status from status routine and publishes events
+func (o *Orchestrator) handle(e Event) {
+	if e.Error != nil {
+		o.publish(e)
+		return
+	}
+	o.mu.Lock()
+	srv, ok := o.service[e.Service]
+	if !ok {
+		o.mu.Unlock()
+		return
+	}
+	prev := srv.ServiceStatus
+	changes := o.recordHistory(e.Service, &prev, &e.Status)
+	srv.ServiceStatus = e.Status.copy()
+	o.mu.Unlock()
+	if len(changes) > 0 {
+		o.persist(func(s Storage) error { return s.SaveStatus(e.Service, &e.Status) })
+	}
+	o.publish(e)
+	if e.Status.HTTPAccessStatus == CheckStateFailed && prev.HTTPAccessStatus != CheckStateFailed {
+		o.publish(Event{Type: EventCheckFailed, Service: e.Service, Status: e.Status})
+	}
+	for _, change := range changes {
+		o.publish(change)
+	}
+	o.evaluateRules(e.Service, &e.Status)
+	o.remediate(e.Service, &e.Status)
+	o.reconcile(e.Service, &e.Status)
+	if o.level() < INFO {
+		o.logf(DEBUG, "'%s' service has HTTP access status=%s", e.Service, e.Status.HTTPAccessStatus)
+		for _, nodeStatus := range e.Status.NodeStatus {
+			o.logf(DEBUG, "'%s' service has status=%s on '%s' node", e.Service, nodeStatus.ServiceStatus, nodeStatus.NodeName)
+		}
+	}
+	o.logf(INFO, "'%s' service has status=%s", e.Service, e.Status.ServiceStatus)
+}
+
+// ServiceStatusRoutine checks service status by its schedule until service is removed
+// or orchestrator is stopped, it is started automatically for registered services
 func (o *Orchestrator) ServiceStatusRoutine(serviceName string) {
-	fMux.Lock()
-	if _, exist := o.status[serviceName]; exist {
-		fMux.Unlock()
-		o.logf(ERROR, "'%s' service already in use", serviceName)
+	o.runStatusR(serviceName, false)
+}
+
+// runStatusR runs status routine of service, paused routine checks status on demand only
+func (o *Orchestrator) runStatusR(serviceName string, paused bool) {
+	ctx, cancel := context.WithCancel(o.ctx)
+	defer cancel()
+	routine := &statusRoutine{paused: paused, cancel: cancel, wake: make(chan bool, 1)}
+	o.mu.Lock()
+	if _, exist := o.routine[serviceName]; exist {
+		o.mu.Unlock()
+		o.logf(DEBUG, "'%s' service status routine is already running", serviceName)
 		return
 	}
-	o.status[serviceName] = true
-	fMux.Unlock()
-	srv, err := o.GetService(serviceName)
-	if err != nil {
-		o.logf(ERROR, err.Error())
-		o.rmStatusR(serviceName)
+	o.routine[serviceName] = routine
+	o.mu.Unlock()
+	defer o.rmStatusR(serviceName, routine)
+	if !o.enter() {
 		return
 	}
-	for { // func ServiceStatus is mutual excluded
-		status, err := o.ServiceStatus(srv.ServiceName) // returns error if only service is unknown
-		if err != nil {                                 // in case on nil service -- routine stops
-			o.ch <- Event{srv.ServiceName, *status, err}
-			o.rmStatusR(srv.ServiceName)
-			o.logf(DEBUG, "'%s' service has status error: %s", srv.ServiceName, err.Error())
-			return
+	defer o.wg.Done()
+	first, check, force := true, false, false
+	for {
+		if check { // unreachable nodes are backed off unless check is triggered
+			status, err := o.serviceStatus(serviceName, force) // returns error if only service is unknown
+			if err != nil {                                    // in case on nil service -- routine stops
+				o.send(Event{Type: EventStatusChecked, Service: serviceName, Error: err})
+				o.logf(DEBUG, "'%s' service has status error: %s", serviceName, err.Error())
+				return
+			}
+			o.send(Event{Type: EventStatusChecked, Service: serviceName, Status: *status})
+			o.logf(DEBUG, "'%s' service has status=%s", serviceName, status.ServiceStatus)
 		}
-		o.ch <- Event{srv.ServiceName, *status, nil}
-		o.logf(DEBUG, "'%s' service has status=%d", srv.ServiceName, status.ServiceStatus)
-		if srv.TimeoutSeconds < 1 {
-			o.rmStatusR(srv.ServiceName)
-			o.logf(WARNING, "'%s' service has too short timeout=%d", srv.ServiceName, srv.TimeoutSeconds)
+		srv, err := o.GetService(serviceName)
+		if err != nil {
 			return
 		}
-		time.Sleep(time.Duration(srv.TimeoutSeconds) * time.Second)
+		var timer <-chan time.Time
+		interval, periodic := srv.interval()
+		o.mu.Lock()
+		if check {
+			routine.lastCheck = time.Now()
+		}
+		routine.nextCheck = time.Time{}
+		paused := routine.paused
+		if !paused && periodic {
+			delay := srv.Schedule.jitter(interval)
+			if first { // routines started together are spread over interval
+				delay = srv.Schedule.splay(interval)
+			}
+			timer = time.After(delay)
+			routine.nextCheck = time.Now().Add(delay)
+		}
+		o.mu.Unlock()
+		if first && !periodic {
+			o.logf(INFO, "'%s' service status is checked on demand only", serviceName)
+			check, force = true, true
+		} else {
+			select {
+			case <-ctx.Done():
+				return
+			case check = <-routine.wake:
+				force = check
+			case <-timer:
+				check, force = true, false
+			}
+		}
+		first = false
 	}
 }
 
-func (o *Orchestrator) rmStatusR(serviceName string) {
-	fMux.Lock()
-	delete(o.status, serviceName)
-	fMux.Unlock()
+func (o *Orchestrator) rmStatusR(serviceName string, routine *statusRoutine) {
+	o.mu.Lock()
+	if o.routine[serviceName] == routine {
+		delete(o.routine, serviceName)
+	}
+	o.mu.Unlock()
 }
 
+// ServiceStatus checks status of service on all its nodes and http access
 func (o *Orchestrator) ServiceStatus(serviceName string) (*ServiceStatusInfo, error) {
+	return o.serviceStatus(serviceName, true)
+}
+
+// serviceStatus checks status of service, unreachable nodes keep their last status
+// until backoff is passed if check is not forced
+func (o *Orchestrator) serviceStatus(serviceName string, force bool) (*ServiceStatusInfo, error) {
 	service, err := o.GetService(serviceName)
 	if err != nil {
 		return nil, err
 	}
-	info := &ServiceStatusInfo{StatusUndefined, StatusUndefined, make([]*NodeStatusInfo, 0), time.Now(), time.Time{}}
-	if service.TimeoutSeconds > 0 {
-		info.NextUpdate = time.Now().Add(time.Duration(service.TimeoutSeconds) * time.Second)
-	}
-	if len(service.HTTPAccess) > 0 {
-		info.HTTPAccessStatus = StatusPassed
-		for _, access := range service.HTTPAccess {
-			err := access.Do()
-			if err != nil {
-				info.HTTPAccessStatus = StatusFailed
-				continue
-			}
-		}
+	info := &ServiceStatusInfo{StatusUndefined, StatusUndefined, make([]*NodeStatusInfo, 0), time.Now(), time.Time{}, false}
+	if interval, periodic := service.interval(); periodic {
+		info.NextUpdate = time.Now().Add(interval)
+	}
+	timeout := service.Schedule.timeout()
+	var wg sync.WaitGroup
+	httpStatus := make([]CheckState, len(service.HTTPAccess))
+	for i, access := range service.HTTPAccess {
+		wg.Add(1)
+		go func(i int, access *HTTPAccess) {
+			defer wg.Done()
+			o.work(func() {
+				httpStatus[i] = CheckStatePassed
+				if err := access.check(timeout); err != nil {
+					o.logf(DEBUG, "'%s' service HTTP access '%s' error: %s", serviceName, access, err.Error())
+					httpStatus[i] = CheckStateFailed
+				}
+			})
+		}(i, access)
 	}
-	for _, node := range service.Nodes {
+	nodes := make([]*NodeStatusInfo, len(service.Nodes))
+	for i, node := range service.Nodes {
 		n, err := o.GetNode(node.NodeName)
 		if err != nil {
+			wg.Wait()
 			return nil, err
 		}
-		nodStatus := &NodeStatusInfo{n.NodeName, node.NodeStatus, StatusUndefined}
-		command := ""
-		switch n.OS {
-		case OSLinux:
-			command = fmt.Sprintf(LinuxTryIsActiveFormatString, serviceName)
-		case OSDarwin:
-			command = fmt.Sprintf(DarwinTryIsActiveFormatString, serviceName)
-		default:
-			nodStatus.ServiceStatus = StatusUnknownOS
+		nodes[i] = &NodeStatusInfo{n.NodeName, n.NodeStatus, ServiceStateUndefined, StatusUndefined}
+		if n.OS != OSLinux && n.OS != OSDarwin {
+			nodes[i].ServiceStatus = StatusUnknownOS
+			continue
 		}
-		if command != "" {
-			out, err := o.RunCommand(n.NodeName, command)
-			if err != nil {
-				o.logf(DEBUG, "Running command error: %s", err.Error())
-				nodStatus.ServiceStatus = StatusDisconnected
-				if info.ServiceStatus == StatusUndefined {
-					info.ServiceStatus = StatusInactive
-				}
-			} else {
-				outStr := strings.ReplaceAll(string(out), "\n", "")
-				o.logf(DEBUG, "Status result by '%s' node: %s", n.NodeName, outStr)
-				numStatus, err := strconv.Atoi(outStr)
-				if err == nil {
-					nodStatus.ServiceStatus = numStatus
-				}
-				if info.ServiceStatus == StatusUndefined && nodStatus.ServiceStatus == StatusActive {
-					info.ServiceStatus = StatusActive
+		if last, backedOff := o.backedOff(serviceName, n.NodeName); backedOff && !force {
+			nodes[i].ServiceStatus, nodes[i].ExitCode = last.ServiceStatus, last.ExitCode
+			continue
+		}
+		wg.Add(1)
+		go func(nodStatus *NodeStatusInfo) { // nodes are probed concurrently, probes are batched per node
+			defer wg.Done()
+			service.NodeCheck.retry(func() error {
+				nodStatus.ServiceStatus, nodStatus.ExitCode = o.probe(nodStatus.NodeName, serviceName, timeout)
+				if nodStatus.ServiceStatus != ServiceStateActive {
+					return o.Errorf("'%s' service is not active on '%s' node", serviceName, nodStatus.NodeName)
 				}
+				return nil
+			})
+			o.backOff(service, nodStatus)
+		}(nodes[i])
+	}
+	wg.Wait()
+	if len(service.HTTPAccess) > 0 {
+		info.HTTPAccessStatus = StatusPassed
+		for i, access := range service.HTTPAccess {
+			if o.debounce(serviceName, "http:"+access.String(), access.CheckPolicy, httpStatus[i].Code()) != StatusPassed {
+				info.HTTPAccessStatus = StatusFailed
+			}
+		}
+	}
+	active, probed := 0, 0
+	for _, nodStatus := range nodes {
+		if nodStatus.ServiceStatus != StatusUnknownOS {
+			nodStatus.ServiceStatus = ServiceState(o.debounce(serviceName, "node:"+nodStatus.NodeName, service.NodeCheck, nodStatus.ServiceStatus.Code()))
+			probed++
+			if nodStatus.ServiceStatus == ServiceStateActive {
+				active++
 			}
 		}
 		info.NodeStatus = append(info.NodeStatus, nodStatus)
 	}
+	if probed > 0 {
+		info.ServiceStatus = service.Aggregation.Aggregate(active, len(service.Nodes))
+	}
+	info.Flapping = o.detectFlapping(serviceName, service.FlapDetection, info.ServiceStatus)
 	return info, nil
 }
 
@@ -336,6 +684,8 @@ func (o *Orchestrator) StartService(nodeName, serviceName string) error {
 		o.logf(ERROR, "'%s' service has not been started on '%s' node. Error message: %s", serviceName, nodeName, err.Error())
 		return err
 	}
+	o.setStoppedByOrchestrator(serviceName, nodeName, false)
+	o.publish(Event{Type: EventServiceStarted, Service: serviceName, Node: nodeName})
 	o.logf(WARNING, "'%s' service has been started on '%s' node", serviceName, nodeName)
 	return nil
 }
@@ -364,65 +714,135 @@ func (o *Orchestrator) StopService(nodeName, serviceName string) error {
 		o.logf(ERROR, "'%s' service has not been started on '%s' node. Error message: %s", serviceName, nodeName, err.Error())
 		return err
 	}
+	o.setStoppedByOrchestrator(serviceName, nodeName, true)
+	o.publish(Event{Type: EventServiceStopped, Service: serviceName, Node: nodeName})
 	o.logf(WARNING, "'%s' service has been stopped on '%s' node", serviceName, nodeName)
 	return nil
 }
 
+// ServiceLogs returns last lines of service logs on node (DefaultLogLines if lines < 1)
+func (o *Orchestrator) ServiceLogs(nodeName, serviceName string, lines int) ([]byte, error) {
+	service, err := o.GetService(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	if lines < 1 {
+		lines = DefaultLogLines
+	}
+	node := new(Node)
+	for _, n := range service.Nodes {
+		if n.NodeName == nodeName {
+			node = n
+		}
+	}
+	command := ""
+	switch node.OS {
+	case OSDarwin:
+		command = fmt.Sprintf(DarwinServiceLogsFormatString, serviceName, lines)
+	case OSLinux:
+		command = fmt.Sprintf(LinuxServiceLogsFormatString, serviceName, lines)
+	default:
+		return nil, o.Errorf("unknown '%s' node or node's OS '%s'", nodeName, node.OS)
+	}
+	return o.RunCommand(node.NodeName, command)
+}
+
 func (o *Orchestrator) ConnectNode(nodeName, passPhrase string) error {
-	fMux.Lock()
-	if _, ok := o.node[nodeName]; !ok {
-		fMux.Unlock()
+	node, err := o.GetNode(nodeName)
+	if err != nil {
 		return o.Errorf("unknown '%s' node", nodeName)
 	}
-	if o.node[nodeName].Connection != nil {
-		client, err := o.node[nodeName].Connect(passPhrase)
-		if err != nil {
-			o.node[nodeName].NodeStatus = StatusDisconnected
-			fMux.Unlock()
-			return o.Errorf("'%s' node connection error: %s", nodeName, err.Error())
+	var client *ssh.Client
+	if node.Connection != nil { // dials without lock
+		client, err = node.Connect(passPhrase)
+	}
+	o.mu.Lock()
+	n, ok := o.node[nodeName]
+	if !ok {
+		o.mu.Unlock()
+		if client != nil {
+			client.Close()
+		}
+		return o.Errorf("unknown '%s' node", nodeName)
+	}
+	prev := n.NodeStatus
+	if err != nil {
+		n.NodeStatus = StatusDisconnected
+		o.mu.Unlock()
+		o.publishNodeStatus(nodeName, prev, NodeStateDisconnected)
+		return o.Errorf("'%s' node connection error: %s", nodeName, err.Error())
+	}
+	if client != nil {
+		if old, exist := o.client[nodeName]; exist {
+			old.Close()
 		}
 		o.client[nodeName] = client
 	}
-	o.node[nodeName].NodeStatus = StatusConnected
-	fMux.Unlock()
+	n.NodeStatus = StatusConnected
+	o.mu.Unlock()
+	o.publishNodeStatus(nodeName, prev, NodeStateConnected)
 	o.logf(WARNING, "'%s' node has been connected", nodeName)
 	return nil
 }
 
 func (o *Orchestrator) DisconnectNode(nodeName string) error {
-	fMux.Lock()
+	o.mu.Lock()
 	if _, ok := o.node[nodeName]; !ok {
-		fMux.Unlock()
+		o.mu.Unlock()
 		return o.Errorf("unknown '%s' node", nodeName)
 	}
+	prev := o.node[nodeName].NodeStatus
 	if o.node[nodeName].Connection != nil {
-		delete(o.client, nodeName)
+		if client, exist := o.client[nodeName]; exist {
+			client.Close()
+			delete(o.client, nodeName)
+		}
 		o.node[nodeName].NodeStatus = StatusDisconnected
 	} else {
 		o.node[nodeName].NodeStatus = StatusConnected
 	}
-	fMux.Unlock()
+	status := o.node[nodeName].NodeStatus
+	o.mu.Unlock()
+	o.publishNodeStatus(nodeName, prev, status)
 	o.logf(WARNING, "'%s' node has been disconnected", nodeName)
 	return nil
 }
 
 func (o *Orchestrator) RunCommand(nodeName, command string) ([]byte, error) {
+	return o.RunCommandContext(context.Background(), nodeName, command)
+}
+
+// RunCommandContext runs command on node, local command is killed with its child processes
+// and ssh session is closed when ctx is done
+func (o *Orchestrator) RunCommandContext(ctx context.Context, nodeName, command string) ([]byte, error) {
 	var out []byte
 	node, err := o.GetNode(nodeName)
 	if err != nil {
 		return nil, err
 	}
 	if node.Connection == nil { // LOCAL
-		var err error
 		switch node.OS {
 		case OSDarwin, OSLinux:
 			o.logf(DEBUG, "'%s' node command: '%s'", nodeName, command)
-			out, err = exec.Command("bash", "-c", command).Output()
+			stdout := new(bytes.Buffer)
+			cmd := exec.Command("bash", "-c", command)
+			cmd.Stdout = stdout
+			setProcessGroup(cmd)
+			if err := cmd.Start(); err != nil {
+				return nil, err
+			}
+			stop := cancelOnDone(ctx, func() { killProcessGroup(cmd) })
+			err := cmd.Wait()
+			stop()
+			if ctx.Err() != nil {
+				return nil, o.Errorf("'%s' node command is cancelled: %s", nodeName, ctx.Err().Error())
+			}
 			if err != nil {
 				return nil, err
 			}
+			out = stdout.Bytes()
 		default:
-			return nil, o.Errorf("remote connection is not provided for '%s' OS", o.node[nodeName].OS)
+			return nil, o.Errorf("remote connection is not provided for '%s' OS", node.OS)
 		}
 	} else { // REMOTE
 		client, err := o.IsNodeConnected(nodeName)
@@ -437,61 +857,118 @@ func (o *Orchestrator) RunCommand(nodeName, command string) ([]byte, error) {
 		switch node.OS {
 		case OSDarwin, OSLinux:
 			o.logf(DEBUG, "'%s' node command: '%s'", nodeName, command)
+			stop := cancelOnDone(ctx, func() {
+				session.Signal(ssh.SIGKILL)
+				session.Close()
+			})
 			out, err = session.CombinedOutput(command)
+			stop()
+			if ctx.Err() != nil {
+				return nil, o.Errorf("'%s' node command is cancelled: %s", nodeName, ctx.Err().Error())
+			}
 			if err != nil {
 				return nil, err
 			}
 		default:
-			return nil, o.Errorf("remote connection is not provided for %s OS", o.node[nodeName].OS)
+			return nil, o.Errorf("remote connection is not provided for %s OS", node.OS)
 		}
 	}
 	return out, nil
 }
 
+// cancelOnDone calls cancel if ctx is done before returned stop is called,
+// stop returns after cancel is finished
+func cancelOnDone(ctx context.Context, cancel func()) (stop func()) {
+	done, finished := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
 func (o *Orchestrator) IsNodeConnected(nodeName string) (*ssh.Client, error) {
-	fMux.Lock()
-	if _, ok := o.node[nodeName]; !ok {
-		fMux.Unlock()
+	o.mu.RLock()
+	_, ok := o.node[nodeName]
+	client, connected := o.client[nodeName]
+	o.mu.RUnlock()
+	if !ok {
 		return nil, o.Errorf("Node access: unknown '%s' node", nodeName)
 	}
-	client, ok := o.client[nodeName]
+	var err error
+	if !connected {
+		err = o.Errorf("Node access: '%s' node has nil Connection", nodeName)
+	} else if session, e := client.NewSession(); e != nil { // checks without lock
+		err = e
+	} else {
+		err = session.Close()
+	}
+	o.mu.Lock()
+	node, ok := o.node[nodeName]
 	if !ok {
-		o.node[nodeName].NodeStatus = StatusDisconnected
-		fMux.Unlock()
-		return nil, o.Errorf("Node access: '%s' node has nil Connection", nodeName)
+		o.mu.Unlock()
+		return nil, o.Errorf("Node access: unknown '%s' node", nodeName)
 	}
-	session, err := client.NewSession()
+	prev := node.NodeStatus
 	if err != nil {
-		o.node[nodeName].NodeStatus = StatusDisconnected
-		fMux.Unlock()
-		return nil, err
+		node.NodeStatus = StatusDisconnected
+	} else {
+		node.NodeStatus = StatusConnected
 	}
-	err = session.Close()
+	status := node.NodeStatus
+	o.mu.Unlock()
+	o.publishNodeStatus(nodeName, prev, status)
 	if err != nil {
-		o.node[nodeName].NodeStatus = StatusDisconnected
-		fMux.Unlock()
 		return nil, err
 	}
-	o.node[nodeName].NodeStatus = StatusConnected
-	fMux.Unlock()
 	return client, nil
 }
 
+// publishNodeStatus publishes node-connected or node-disconnected event
+// if node status has been changed
+func (o *Orchestrator) publishNodeStatus(nodeName string, prev, status NodeState) {
+	if prev == status {
+		return
+	}
+	switch status {
+	case NodeStateConnected:
+		o.publish(Event{Type: EventNodeConnected, Node: nodeName})
+	case NodeStateDisconnected:
+		o.publish(Event{Type: EventNodeDisconnected, Node: nodeName})
+	}
+}
+
 func (o *Orchestrator) SetLogLevel(lvl int) {
-	if lvl > -1 && lvl < 5 {
-		o.logLevel = lvl
-	} else {
-		o.logLevel = INFO
+	if lvl < 0 || lvl > 4 {
+		lvl = INFO
 	}
+	atomic.StoreInt32(&o.logLevel, int32(lvl))
+}
+
+// OverrideLogLevel sets log level which is kept on loading and reloading configuration
+func (o *Orchestrator) OverrideLogLevel(lvl int) {
+	o.mu.Lock()
+	o.logPinned = true
+	o.mu.Unlock()
+	o.SetLogLevel(lvl)
+}
+
+func (o *Orchestrator) level() int {
+	return int(atomic.LoadInt32(&o.logLevel))
 }
 
 func (o *Orchestrator) logf(lvl int, format string, msg ...interface{}) {
-	fMux.Lock()
 	var logLevels = map[int]string{DEBUG: "Debug", INFO: "Info", WARNING: "Warning", ERROR: "Error"}
-	if t, ok := logLevels[lvl]; ok && lvl >= o.logLevel {
+	if t, ok := logLevels[lvl]; ok && lvl >= o.level() {
 		log.Printf("%s | Orchestrator | %s | %s", time.Now().Format(time.RFC3339), t, fmt.Sprintf(format, msg...))
 	}
-	fMux.Unlock()
 }
 
 func (o *Orchestrator) Errorf(format string, msg ...interface{}) error {
@@ -0,0 +1,255 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSystemctl puts systemctl which reports every unit as active first in PATH
+func fakeSystemctl(t *testing.T) func() {
+	return fakeCommand(t, "systemctl", "[ \"$1\" = is-active ] || exit 0\nshift\nfor unit in \"$@\"; do echo active; done\n")
+}
+
+func localNode() *Node {
+	return NewNode(&NodeInfo{NodeName: "local", OS: OSLinux})
+}
+
+// startOrchestrator returns started orchestrator with local node
+func startOrchestrator(t *testing.T) *Orchestrator {
+	o := NewOrchestrator()
+	if err := o.RegistrateNodes(localNode()); err != nil {
+		t.Fatal(err)
+	}
+	go o.Start(context.Background())
+	return o
+}
+
+func TestConcurrentRegistry(t *testing.T) {
+	defer fakeSystemctl(t)()
+	o := startOrchestrator(t)
+	defer o.Stop()
+
+	done := make(chan struct{})
+	readers := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				o.copyServicesAsArray()
+				o.copyNodesAsMap()
+				o.StatusRoutines()
+				if _, err := o.GetNode("local"); err != nil {
+					t.Error(err)
+				}
+				if err := o.UpdateNode(&NodeInfo{NodeName: "local", OS: OSLinux}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+
+	writers := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			name := fmt.Sprintf("service-%d", i)
+			for j := 0; j < 20; j++ {
+				info := &ServiceInfo{ServiceName: name, TimeoutSeconds: 1}
+				if err := o.RegistrateServices(NewService(info, localNode())); err != nil {
+					t.Error(err)
+					return
+				}
+				info.TimeoutSeconds = 2
+				if err := o.UpdateService(info); err != nil {
+					t.Error(err)
+				}
+				status, err := o.ServiceStatus(name)
+				if err != nil {
+					t.Error(err)
+				} else if status.ServiceStatus != ServiceStateActive {
+					t.Errorf("'%s' service has status=%s, expected %s", name, status.ServiceStatus, ServiceStateActive)
+				}
+				o.PauseStatusRoutine(name) // routine may not be running yet
+				o.TriggerStatusCheck(name)
+				o.ResumeStatusRoutine(name)
+				if srv, err := o.GetService(name); err != nil {
+					t.Error(err)
+				} else if srv.TimeoutSeconds != 2 {
+					t.Errorf("'%s' service has not been updated", name)
+				}
+				if err := o.RemoveService(name); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	writers.Wait()
+	close(done)
+	readers.Wait()
+
+	if services := o.copyServicesAsArray(); len(services) != 0 {
+		t.Errorf("%d services are left after removing", len(services))
+	}
+}
+
+func TestConcurrentAPI(t *testing.T) {
+	defer fakeSystemctl(t)()
+	o := startOrchestrator(t)
+	defer o.Stop()
+	for i := 0; i < 4; i++ {
+		info := &ServiceInfo{ServiceName: fmt.Sprintf("service-%d", i), TimeoutSeconds: 1}
+		if err := o.RegistrateServices(NewService(info, localNode())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(o.Server())
+	defer server.Close()
+
+	request := func(method, path, body string) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			t.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("service-%d", i%4)
+			for j := 0; j < 10; j++ {
+				request(http.MethodGet, "/orchestrator/services", "")
+				request(http.MethodGet, "/orchestrator/services/"+name, "")
+				request(http.MethodGet, "/orchestrator/nodes", "")
+				request(http.MethodGet, "/orchestrator/statuses", "")
+				request(http.MethodGet, "/orchestrator/statuses/"+name+"/history", "")
+				request(http.MethodGet, "/orchestrator/routines", "")
+				request(http.MethodPut, "/orchestrator/services", fmt.Sprintf(`{"ServiceName":"%s","TimeoutSeconds":%d}`, name, j+1))
+				request(http.MethodPost, "/orchestrator/routines/"+name+"/trigger", "")
+				request(http.MethodPost, "/orchestrator/routines/"+name+"/pause", "")
+				request(http.MethodPost, "/orchestrator/routines/"+name+"/resume", "")
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestOrchestratorsCoexist(t *testing.T) {
+	defer fakeSystemctl(t)()
+	orchestrators := []*Orchestrator{startOrchestrator(t), startOrchestrator(t)}
+	wg := sync.WaitGroup{}
+	for i, o := range orchestrators {
+		defer o.Stop()
+		wg.Add(1)
+		go func(i int, o *Orchestrator) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				info := &ServiceInfo{ServiceName: fmt.Sprintf("service-%d", j), TimeoutSeconds: i + 1}
+				if err := o.RegistrateServices(NewService(info, localNode())); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i, o)
+	}
+	wg.Wait()
+	for i, o := range orchestrators {
+		services := o.copyServicesAsArray()
+		if len(services) != 20 {
+			t.Fatalf("orchestrator %d has %d services, expected 20", i, len(services))
+		}
+		for _, srv := range services {
+			if srv.TimeoutSeconds != i+1 {
+				t.Errorf("'%s' service of orchestrator %d is registered by another orchestrator", srv.ServiceName, i)
+			}
+		}
+	}
+}
+
+func TestRegistrateServicesRejectsDuplicates(t *testing.T) {
+	o := NewOrchestrator()
+	if err := o.RegistrateNodes(localNode()); err != nil {
+		t.Fatal(err)
+	}
+	first := NewService(&ServiceInfo{ServiceName: "a", TimeoutSeconds: 1}, localNode())
+	second := NewService(&ServiceInfo{ServiceName: "a", TimeoutSeconds: 2}, localNode())
+	if err := o.RegistrateServices(first, second); err == nil {
+		t.Fatal("services with the same name are registered")
+	}
+	if services := o.copyServicesAsArray(); len(services) != 0 {
+		t.Errorf("%d services are registered by rejected batch", len(services))
+	}
+}
+
+func TestSnapshotsAreDeepCopies(t *testing.T) {
+	o := NewOrchestrator()
+	node := NewNode(&NodeInfo{NodeName: "remote", OS: OSLinux,
+		Connection: &Connection{Host: "10.0.0.1", Port: "22", User: "root", SSHKey: "/tmp/id_rsa"}})
+	if err := o.RegistrateNodes(node); err != nil {
+		t.Fatal(err)
+	}
+	info := &ServiceInfo{
+		ServiceName:  "s",
+		HTTPAccess:   []*HTTPAccess{{Method: "GET", Address: "http://10.0.0.1/", StatusCode: 200, Headers: map[string]string{"Accept": "text/plain"}}},
+		DesiredState: map[string]string{"remote": DesiredRunning},
+		DependsOn:    []Dependency{{ServiceName: "db"}},
+	}
+	if err := o.RegistrateServices(NewService(&ServiceInfo{ServiceName: "db"}, node), NewService(info, node)); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := o.GetNode("remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Connection.Host = "10.0.0.2"
+	n.NodeStatus = StatusConnected
+	s, err := o.GetService("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Nodes[0].Connection.Host = "10.0.0.2"
+	s.HTTPAccess[0].Headers["Accept"] = "application/json"
+	s.HTTPAccess[0].Address = "http://10.0.0.2/"
+	s.DesiredState["remote"] = DesiredStopped
+	s.DependsOn[0].ServiceName = "cache"
+	s.ServiceStatus.NodeStatus = append(s.ServiceStatus.NodeStatus, &NodeStatusInfo{NodeName: "remote"})
+
+	if n, _ = o.GetNode("remote"); n.Connection.Host != "10.0.0.1" || n.NodeStatus == StatusConnected {
+		t.Errorf("registered node is modified by its snapshot: %+v", n)
+	}
+	s, _ = o.GetService("s")
+	if s.Nodes[0].Connection.Host != "10.0.0.1" {
+		t.Errorf("service's node is modified by snapshot: %s", s.Nodes[0].Connection.Host)
+	}
+	if s.HTTPAccess[0].Headers["Accept"] != "text/plain" || s.HTTPAccess[0].Address != "http://10.0.0.1/" {
+		t.Errorf("HTTP access is modified by snapshot: %+v", s.HTTPAccess[0])
+	}
+	if s.DesiredState["remote"] != DesiredRunning || s.DependsOn[0].ServiceName != "db" || len(s.ServiceStatus.NodeStatus) != 0 {
+		t.Errorf("service is modified by snapshot: %v, %v, %d node statuses", s.DesiredState, s.DependsOn, len(s.ServiceStatus.NodeStatus))
+	}
+}
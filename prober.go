@@ -0,0 +1,193 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DEFAULT PROBE LIMITS
+const (
+	DefaultProbeWorkers = 32 // status commands and http checks running at once
+	DefaultNodeProbes   = 2  // status commands running at once on the same node
+	ProbeBatchWindow    = 20 * time.Millisecond
+)
+
+// probeResult is a state of service on node by status command
+type probeResult struct {
+	state    ServiceState
+	exitCode int
+}
+
+// probeBatch is a single status command checking several services on node
+type probeBatch struct {
+	services []string
+	timeout  time.Duration // the longest timeout of joined probes, command is cancelled after it
+	result   map[string]probeResult
+	done     chan struct{}
+}
+
+type nodeProber struct {
+	pending *probeBatch   // batch collecting services, nil if there is no one
+	slots   chan struct{} // per-node concurrency cap
+}
+
+// SetProbeLimits sets global number of probe workers and number of status commands
+// running at once on the same node
+func (o *Orchestrator) SetProbeLimits(workers, perNode int) error {
+	if workers < 1 || perNode < 1 {
+		return o.Errorf("probe limits must be positive")
+	}
+	o.mu.Lock()
+	o.workers = make(chan struct{}, workers)
+	o.nodeProbes = perNode
+	for _, prober := range o.prober {
+		prober.slots = make(chan struct{}, perNode)
+	}
+	o.mu.Unlock()
+	return nil
+}
+
+// work runs f in one of global probe workers
+func (o *Orchestrator) work(f func()) {
+	o.mu.RLock()
+	workers := o.workers
+	o.mu.RUnlock()
+	workers <- struct{}{}
+	defer func() { <-workers }()
+	f()
+}
+
+// probe returns state of service on node, concurrent probes of the same node are batched
+// into one status command, node is unreachable if command is not finished in timeout,
+// command itself is cancelled if it runs longer than timeout
+func (o *Orchestrator) probe(nodeName, serviceName string, timeout time.Duration) (ServiceState, int) {
+	o.mu.Lock()
+	prober, exist := o.prober[nodeName]
+	if !exist {
+		prober = &nodeProber{slots: make(chan struct{}, o.nodeProbes)}
+		o.prober[nodeName] = prober
+	}
+	batch := prober.pending
+	if batch == nil {
+		batch = &probeBatch{[]string{}, timeout, nil, make(chan struct{})}
+		prober.pending = batch
+		go o.runBatch(nodeName, prober, batch)
+	}
+	found := false
+	for _, name := range batch.services {
+		found = found || name == serviceName
+	}
+	if !found {
+		batch.services = append(batch.services, serviceName)
+	}
+	if timeout > batch.timeout {
+		batch.timeout = timeout
+	}
+	o.mu.Unlock()
+	select {
+	case <-batch.done:
+	case <-time.After(timeout):
+		o.logf(DEBUG, "'%s' service status on '%s' node is not checked in %s", serviceName, nodeName, timeout)
+		return ServiceStateUnreachable, StatusUndefined
+	}
+	result, exist := batch.result[serviceName]
+	if !exist {
+		return ServiceStateUndefined, StatusUndefined
+	}
+	return result.state, result.exitCode
+}
+
+func (o *Orchestrator) runBatch(nodeName string, prober *nodeProber, batch *probeBatch) {
+	defer close(batch.done)
+	time.Sleep(ProbeBatchWindow) // other routines join the batch
+	o.mu.RLock()
+	slots := prober.slots
+	o.mu.RUnlock()
+	slots <- struct{}{} // batch keeps collecting services while node is busy
+	defer func() { <-slots }()
+	o.work(func() {
+		o.mu.Lock()
+		if prober.pending == batch {
+			prober.pending = nil
+		}
+		services := append([]string{}, batch.services...)
+		timeout := batch.timeout
+		o.mu.Unlock()
+		ctx, cancel := context.WithTimeout(o.ctx, timeout)
+		defer cancel()
+		batch.result = o.batchStatus(ctx, nodeName, services) // slots are released after command is finished or killed
+	})
+}
+
+// batchStatus runs one status command for all services on node
+func (o *Orchestrator) batchStatus(ctx context.Context, nodeName string, services []string) map[string]probeResult {
+	result := make(map[string]probeResult)
+	node, err := o.GetNode(nodeName)
+	if err != nil {
+		return result
+	}
+	command := ""
+	switch node.OS {
+	case OSLinux:
+		command = fmt.Sprintf(LinuxBatchIsActiveFormatString, strings.Join(services, " "))
+	case OSDarwin:
+		command = DarwinListFormatString
+	default:
+		for _, service := range services {
+			result[service] = probeResult{StatusUnknownOS, StatusUndefined}
+		}
+		return result
+	}
+	out, err := o.RunCommandContext(ctx, nodeName, command)
+	if err != nil {
+		o.logf(DEBUG, "Running command error: %s", err.Error())
+		for _, service := range services {
+			result[service] = probeResult{ServiceStateUnreachable, StatusUndefined}
+		}
+		return result
+	}
+	o.logf(DEBUG, "Status result by '%s' node: %s", nodeName, strings.ReplaceAll(string(out), "\n", " "))
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	switch node.OS {
+	case OSLinux: // one line per service in order of arguments
+		if len(lines) != len(services) {
+			for _, service := range services {
+				result[service] = probeResult{ServiceStateUndefined, StatusUndefined}
+			}
+			return result
+		}
+		for i, service := range services {
+			state, known := linuxStates[strings.TrimSpace(lines[i])]
+			if !known {
+				state = probeResult{ServiceStateUndefined, LinuxUnknownExitCode}
+			}
+			result[service] = state
+		}
+	case OSDarwin: // like grep of launchctl list by label column: PID, status, label
+		listed := make(map[string]bool)
+		for _, line := range lines {
+			if fields := strings.Fields(line); len(fields) == 3 {
+				listed[fields[2]] = true
+			}
+		}
+		for _, service := range services {
+			result[service] = probeResult{ServiceStateInactive, DarwinNotListedExitCode}
+			if listed[service] {
+				result[service] = probeResult{ServiceStateActive, 0}
+			}
+		}
+	}
+	return result
+}
+
+// linuxStates are states of systemctl is-active with its exit codes for single unit
+var linuxStates = map[string]probeResult{
+	"active":       {ServiceStateActive, 0},
+	"reloading":    {ServiceStateActive, 0},
+	"inactive":     {ServiceStateInactive, LinuxInactiveExitCode},
+	"failed":       {ServiceStateInactive, LinuxInactiveExitCode},
+	"activating":   {ServiceStateUndefined, LinuxInactiveExitCode}, // transitional
+	"deactivating": {ServiceStateUndefined, LinuxInactiveExitCode},
+}
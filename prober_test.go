@@ -0,0 +1,134 @@
+package orchestrator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeCommand puts script named as command first in PATH
+func fakeCommand(t *testing.T, command, script string) func() {
+	dir, err := ioutil.TempDir("", "orchestrator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, command), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBatchStatusLinux(t *testing.T) {
+	defer fakeCommand(t, "systemctl", "shift\nfor unit in \"$@\"; do echo \"$unit\"; done\n")() // state is a name of unit
+	o := NewOrchestrator()
+	if err := o.RegistrateNodes(localNode()); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]probeResult{
+		"active":     {ServiceStateActive, 0},
+		"inactive":   {ServiceStateInactive, LinuxInactiveExitCode},
+		"failed":     {ServiceStateInactive, LinuxInactiveExitCode},
+		"activating": {ServiceStateUndefined, LinuxInactiveExitCode},
+		"unknown":    {ServiceStateUndefined, LinuxUnknownExitCode},
+	}
+	services := []string{}
+	for service := range expected {
+		services = append(services, service)
+	}
+	result := o.batchStatus(context.Background(), "local", services)
+	for service, state := range expected {
+		if result[service] != state {
+			t.Errorf("'%s' service has %v, expected %v", service, result[service], state)
+		}
+	}
+}
+
+func TestBatchStatusDarwin(t *testing.T) {
+	defer fakeCommand(t, "launchctl", "printf 'PID\\tStatus\\tLabel\\n123\\t0\\tfoo\\n-\\t0\\tcom.example.bar\\n'\n")()
+	o := NewOrchestrator()
+	if err := o.RegistrateNodes(NewNode(&NodeInfo{NodeName: "local", OS: OSDarwin})); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]probeResult{
+		"foo":             {ServiceStateActive, 0},
+		"fo":              {ServiceStateInactive, DarwinNotListedExitCode}, // label is matched exactly
+		"bar":             {ServiceStateInactive, DarwinNotListedExitCode},
+		"com.example.bar": {ServiceStateActive, 0},
+	}
+	services := []string{}
+	for service := range expected {
+		services = append(services, service)
+	}
+	result := o.batchStatus(context.Background(), "local", services)
+	for service, state := range expected {
+		if result[service] != state {
+			t.Errorf("'%s' service has %v, expected %v", service, result[service], state)
+		}
+	}
+}
+
+// probeSlotsFree waits until all probe workers and per-node slots are released
+func probeSlotsFree(o *Orchestrator, wait time.Duration) bool {
+	deadline := time.Now().Add(wait)
+	for time.Now().Before(deadline) {
+		o.mu.RLock()
+		busy := len(o.workers)
+		for _, prober := range o.prober {
+			busy += len(prober.slots)
+		}
+		o.mu.RUnlock()
+		if busy == 0 {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestProbeCancelsHungCommand(t *testing.T) {
+	defer fakeCommand(t, "systemctl", "sleep 100\n")()
+	o := NewOrchestrator()
+	defer o.Stop()
+	if err := o.RegistrateNodes(localNode()); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := o.probe("local", "a", 200*time.Millisecond); state != ServiceStateUnreachable {
+		t.Errorf("hung probe has %s status, expected unreachable", state)
+	}
+	if !probeSlotsFree(o, 2*time.Second) {
+		t.Error("hung command keeps probe slots")
+	}
+}
+
+func TestHungNodeDoesNotStarveOthers(t *testing.T) {
+	defer fakeCommand(t, "systemctl", "sleep 100\n")()
+	o := NewOrchestrator()
+	defer o.Stop()
+	if err := o.SetProbeLimits(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	remote := NewNode(&NodeInfo{NodeName: "remote", OS: OSLinux, Connection: &Connection{Host: "10.0.0.1", Port: "22", User: "root", SSHKey: "/tmp/id_rsa"}})
+	if err := o.RegistrateNodes(localNode(), remote); err != nil {
+		t.Fatal(err)
+	}
+	hung := make(chan struct{})
+	go func() {
+		defer close(hung)
+		o.probe("local", "a", 300*time.Millisecond)
+	}()
+	time.Sleep(100 * time.Millisecond) // hung command takes the only worker
+	start := time.Now()
+	o.probe("remote", "a", 5*time.Second) // is not connected -- fails at once when it gets worker
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("probe of remote node has waited for hung node %s", elapsed)
+	}
+	<-hung
+}
@@ -0,0 +1,225 @@
+package orchestrator
+
+import (
+	"fmt"
+	"time"
+)
+
+// DESIRED STATES of service on node
+const (
+	DesiredRunning = "running"
+	DesiredStopped = "stopped"
+)
+
+// RECONCILE ACTIONS
+const (
+	ActionStart = "start"
+	ActionStop  = "stop"
+)
+
+// RECONCILER BACKOFF of repeated attempts to fix drift of service on node, doubled on each attempt
+const (
+	ReconcileBackoff    = 10 * time.Second
+	ReconcileMaxBackoff = 10 * time.Minute
+)
+
+// driftState is a drift of service on node which has not been fixed yet
+type driftState struct {
+	attempts    int
+	nextAttempt time.Time
+}
+
+func reconcileBackoff(attempts int) time.Duration {
+	backoff := ReconcileBackoff
+	for i := 1; i < attempts && backoff < ReconcileMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > ReconcileMaxBackoff {
+		return ReconcileMaxBackoff
+	}
+	return backoff
+}
+
+// ReconcileAction is a drift of service state on node from desired state
+type ReconcileAction struct {
+	Service string
+	Node    string
+	Desired string
+	Actual  ServiceState
+	Action  string // start / stop
+	Error   string `json:",omitempty"`
+}
+
+// ReconcilePlan is a list of actions converging actual state to desired state
+type ReconcilePlan struct {
+	DryRun  bool
+	Time    time.Time
+	Actions []*ReconcileAction
+}
+
+// SetDesiredState sets desired state (running / stopped) of service on node,
+// empty state means service is not managed by reconciler on node
+func (o *Orchestrator) SetDesiredState(serviceName, nodeName, state string) error {
+	if state != "" && state != DesiredRunning && state != DesiredStopped {
+		return o.Errorf("unknown '%s' desired state", state)
+	}
+	o.mu.Lock()
+	service, exist := o.service[serviceName]
+	if !exist {
+		o.mu.Unlock()
+		return o.Errorf("'%s' service is not exist", serviceName)
+	}
+	found := false
+	for _, node := range service.Nodes {
+		if node.NodeName == nodeName {
+			found = true
+		}
+	}
+	if !found {
+		o.mu.Unlock()
+		return o.Errorf("'%s' service has no '%s' node", serviceName, nodeName)
+	}
+	desired := make(map[string]string)
+	for n, s := range service.DesiredState {
+		desired[n] = s
+	}
+	if state == "" {
+		delete(desired, nodeName)
+	} else {
+		desired[nodeName] = state
+	}
+	service.DesiredState = desired
+	cp := service.copy()
+	o.mu.Unlock()
+	o.persist(func(s Storage) error { return s.SaveService(cp) })
+	o.logf(INFO, "'%s' service has desired state '%s' on '%s' node", serviceName, state, nodeName)
+	return nil
+}
+
+// SetReconcileDryRun switches reconciler into dry-run mode: drift is reported but not fixed
+func (o *Orchestrator) SetReconcileDryRun(dryRun bool) {
+	o.mu.Lock()
+	o.dryRun = dryRun
+	o.mu.Unlock()
+}
+
+// Plan returns drift of all services from their desired states by the latest statuses
+func (o *Orchestrator) Plan() *ReconcilePlan {
+	plan := &ReconcilePlan{true, time.Now(), []*ReconcileAction{}}
+	for _, service := range o.copyServicesAsArray() {
+		plan.Actions = append(plan.Actions, o.drift(service, &service.ServiceStatus)...)
+	}
+	return plan
+}
+
+// Reconcile converges all services to their desired states once, nothing is changed if dryRun
+func (o *Orchestrator) Reconcile(dryRun bool) *ReconcilePlan {
+	plan := o.Plan()
+	plan.DryRun = dryRun
+	if !dryRun {
+		for _, action := range plan.Actions {
+			o.apply(action)
+		}
+	}
+	return plan
+}
+
+// drift compares service status on nodes with desired states, nodes under maintenance
+// and nodes with unknown service status are skipped
+func (o *Orchestrator) drift(service *Service, status *ServiceStatusInfo) []*ReconcileAction {
+	actions := []*ReconcileAction{}
+	for _, nodeStatus := range status.NodeStatus {
+		desired := service.DesiredState[nodeStatus.NodeName]
+		action := ""
+		switch {
+		case desired == DesiredRunning && nodeStatus.ServiceStatus == ServiceStateInactive:
+			action = ActionStart
+		case desired == DesiredStopped && nodeStatus.ServiceStatus == ServiceStateActive:
+			action = ActionStop
+		default:
+			continue
+		}
+		if o.InMaintenance(service.ServiceName, nodeStatus.NodeName) {
+			continue
+		}
+		actions = append(actions, &ReconcileAction{service.ServiceName, nodeStatus.NodeName, desired, nodeStatus.ServiceStatus, action, ""})
+	}
+	return actions
+}
+
+func (o *Orchestrator) apply(action *ReconcileAction) {
+	var err error
+	switch action.Action {
+	case ActionStart:
+		err = o.StartService(action.Node, action.Service)
+	case ActionStop:
+		err = o.StopService(action.Node, action.Service)
+	}
+	if err != nil {
+		action.Error = err.Error()
+	}
+}
+
+// reconcile reports drift of service from desired state and fixes it unless reconciler is in dry-run mode,
+// repeated attempts on the same node are backed off until drift is fixed
+func (o *Orchestrator) reconcile(serviceName string, status *ServiceStatusInfo) {
+	service, err := o.GetService(serviceName)
+	if err != nil || len(service.DesiredState) < 1 {
+		return
+	}
+	now := time.Now()
+	actions := o.drift(service, status)
+	due := []*ReconcileAction{}
+	events := []Event{}
+	o.mu.Lock()
+	drifted := make(map[string]*driftState)
+	for _, action := range actions {
+		key := serviceName + "/" + action.Node
+		state, exist := o.drifted[key]
+		if !exist {
+			state = &driftState{}
+			events = append(events, Event{Type: EventDrift, Service: serviceName, Node: action.Node, Status: *status,
+				Error: fmt.Errorf("'%s' service is %s on '%s' node, desired state is '%s'", serviceName, action.Actual, action.Node, action.Desired)})
+		}
+		drifted[key] = state
+		if !now.Before(state.nextAttempt) {
+			due = append(due, action)
+		}
+	}
+	for _, node := range service.Nodes {
+		delete(o.drifted, serviceName+"/"+node.NodeName)
+	}
+	for key, state := range drifted {
+		o.drifted[key] = state
+	}
+	apply := !o.dryRun && len(due) > 0 && !o.reconciling[serviceName]
+	if apply {
+		o.reconciling[serviceName] = true
+		for _, action := range due {
+			state := drifted[serviceName+"/"+action.Node]
+			state.attempts++
+			state.nextAttempt = now.Add(reconcileBackoff(state.attempts))
+		}
+	}
+	o.mu.Unlock()
+	for _, e := range events {
+		o.publish(e)
+	}
+	if !apply {
+		return
+	}
+	started := o.spawn(func() {
+		for _, action := range due {
+			o.logf(WARNING, "reconciler: %s '%s' service on '%s' node", action.Action, action.Service, action.Node)
+			o.apply(action)
+		}
+		o.mu.Lock()
+		delete(o.reconciling, serviceName)
+		o.mu.Unlock()
+	})
+	if !started {
+		o.mu.Lock()
+		delete(o.reconciling, serviceName)
+		o.mu.Unlock()
+	}
+}
@@ -0,0 +1,155 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReconcileBackoff(t *testing.T) {
+	calls, err := ioutil.TempFile("", "systemctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls.Close()
+	defer os.Remove(calls.Name())
+	defer fakeCommand(t, "systemctl", "echo \"$@\" >> "+calls.Name()+"\n")()
+	starts := func() int {
+		data, _ := ioutil.ReadFile(calls.Name())
+		return strings.Count(string(data), "start a")
+	}
+
+	o := NewOrchestrator()
+	defer o.Stop()
+	if err := o.RegistrateNodes(localNode()); err != nil {
+		t.Fatal(err)
+	}
+	info := &ServiceInfo{ServiceName: "a", DesiredState: map[string]string{"local": DesiredRunning}}
+	if err := o.RegistrateServices(NewService(info, localNode())); err != nil {
+		t.Fatal(err)
+	}
+	inactive := &ServiceStatusInfo{ServiceStatus: ServiceStateInactive,
+		NodeStatus: []*NodeStatusInfo{{NodeName: "local", NodeStatus: StatusConnected, ServiceStatus: ServiceStateInactive}}}
+	reconcile := func() {
+		o.reconcile("a", inactive)
+		for { // waits for applying
+			o.mu.RLock()
+			reconciling := o.reconciling["a"]
+			o.mu.RUnlock()
+			if !reconciling {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		reconcile()
+	}
+	if n := starts(); n != 1 {
+		t.Fatalf("service is started %d times, expected 1 until backoff is passed", n)
+	}
+	o.mu.Lock()
+	state := o.drifted["a/local"]
+	if state.nextAttempt.Sub(time.Now()) <= ReconcileBackoff/2 {
+		t.Errorf("next attempt is in %s, expected %s", state.nextAttempt.Sub(time.Now()), ReconcileBackoff)
+	}
+	state.nextAttempt = time.Now() // backoff is passed
+	o.mu.Unlock()
+	reconcile()
+	if n := starts(); n != 2 {
+		t.Fatalf("service is started %d times, expected 2 after backoff", n)
+	}
+	o.mu.RLock()
+	next := o.drifted["a/local"].nextAttempt
+	o.mu.RUnlock()
+	if next.Sub(time.Now()) <= ReconcileBackoff {
+		t.Errorf("next attempt is in %s, expected %s", next.Sub(time.Now()), 2*ReconcileBackoff)
+	}
+
+	o.reconcile("a", &ServiceStatusInfo{ServiceStatus: ServiceStateActive,
+		NodeStatus: []*NodeStatusInfo{{NodeName: "local", NodeStatus: StatusConnected, ServiceStatus: ServiceStateActive}}})
+	o.mu.RLock()
+	_, drifted := o.drifted["a/local"]
+	o.mu.RUnlock()
+	if drifted {
+		t.Error("drift is kept after service has converged")
+	}
+}
+
+func TestDesiredStateOfUnknownNode(t *testing.T) {
+	o := NewOrchestrator()
+	if err := o.RegistrateNodes(localNode()); err != nil {
+		t.Fatal(err)
+	}
+	info := &ServiceInfo{ServiceName: "a", DesiredState: map[string]string{"remote": DesiredRunning}}
+	if err := o.RegistrateServices(NewService(info, localNode())); err == nil {
+		t.Error("desired state of node which is not a node of service is accepted")
+	}
+}
+
+func TestReconcileBackoffLimit(t *testing.T) {
+	for attempts, expected := range map[int]time.Duration{1: ReconcileBackoff, 2: 2 * ReconcileBackoff, 100: ReconcileMaxBackoff} {
+		if backoff := reconcileBackoff(attempts); backoff != expected {
+			t.Errorf("backoff of %d attempts is %s, expected %s", attempts, backoff, expected)
+		}
+	}
+}
+
+// encodingStorage encodes saved services like file storage does
+type encodingStorage struct {
+	Storage
+}
+
+func (s *encodingStorage) Load() (*StorageState, error) { return &StorageState{}, nil }
+
+func (s *encodingStorage) SaveNode(node *Node) error { return nil }
+
+func (s *encodingStorage) SaveService(service *Service) error {
+	_, err := json.Marshal(service)
+	return err
+}
+
+func TestSetDesiredStateSavesSnapshot(t *testing.T) {
+	o := NewOrchestrator()
+	if err := o.SetStorage(&encodingStorage{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.RegistrateNodes(localNode()); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.RegistrateServices(NewService(&ServiceInfo{ServiceName: "a"}, localNode())); err != nil {
+		t.Fatal(err)
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			nodeOS := OSLinux
+			if i%2 == 0 {
+				nodeOS = OSDarwin
+			}
+			if err := o.UpdateNode(&NodeInfo{NodeName: "local", OS: nodeOS}); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			state := DesiredRunning
+			if i%2 == 0 {
+				state = DesiredStopped
+			}
+			if err := o.SetDesiredState("a", "local", state); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,372 @@
+package orchestrator
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultConfigWatchInterval is a period of checking configuration file for changes
+const DefaultConfigWatchInterval = 5 * time.Second
+
+// ConfigDiff describes changes of configuration against registered nodes and services
+type ConfigDiff struct {
+	NodesAdded      []string
+	NodesRemoved    []string
+	NodesUpdated    []string
+	ServicesAdded   []string
+	ServicesRemoved []string
+	ServicesUpdated []string
+	Applied         bool // false for dry run or if there are no changes
+}
+
+func (d *ConfigDiff) Empty() bool {
+	return len(d.NodesAdded)+len(d.NodesRemoved)+len(d.NodesUpdated)+
+		len(d.ServicesAdded)+len(d.ServicesRemoved)+len(d.ServicesUpdated) == 0
+}
+
+func (d *ConfigDiff) String() string {
+	if d.Empty() {
+		return "no changes"
+	}
+	changes := []string{}
+	add := func(what string, names []string) {
+		if len(names) > 0 {
+			changes = append(changes, fmt.Sprintf("%s: %s", what, strings.Join(names, ", ")))
+		}
+	}
+	add("nodes added", d.NodesAdded)
+	add("nodes removed", d.NodesRemoved)
+	add("nodes updated", d.NodesUpdated)
+	add("services added", d.ServicesAdded)
+	add("services removed", d.ServicesRemoved)
+	add("services updated", d.ServicesUpdated)
+	return strings.Join(changes, "; ")
+}
+
+// ReloadConfig reads configuration file loaded by LoadConfig again and applies only its changes:
+// nodes and services are added, removed or updated, status routines of affected services are restarted.
+// Nothing is applied if configuration is not valid, with dryRun changes are reported only
+func (o *Orchestrator) ReloadConfig(dryRun bool) (*ConfigDiff, error) {
+	o.reload.Lock()
+	defer o.reload.Unlock()
+	o.mu.RLock()
+	path := o.configPath
+	o.mu.RUnlock()
+	if path == "" {
+		return nil, o.Errorf("configuration has not been loaded")
+	}
+	diff, err := o.reloadConfig(path, dryRun)
+	if dryRun {
+		return diff, err
+	}
+	if err != nil {
+		o.publish(Event{Type: EventConfigReloaded, Error: err})
+		o.logf(ERROR, "'%s' config has not been reloaded: %s", path, err.Error())
+		return diff, err
+	}
+	o.publish(Event{Type: EventConfigReloaded})
+	o.logf(INFO, "'%s' config has been reloaded: %s", path, diff)
+	return diff, nil
+}
+
+func (o *Orchestrator) reloadConfig(path string, dryRun bool) (*ConfigDiff, error) {
+	config, err := ParseConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	nodes, services := config.nodes, config.services
+	if dryRun {
+		o.mu.RLock()
+		defer o.mu.RUnlock()
+		return o.diffConfig(nodes, services)
+	}
+	diff, err := o.applyConfig(nodes, services)
+	if err != nil {
+		return diff, err
+	}
+	o.configure(config)
+	diff.Applied = !diff.Empty()
+	return diff, nil
+}
+
+// diffConfig compares nodes and services of configuration with registered ones
+// and checks that changes can be applied, must be called under lock
+func (o *Orchestrator) diffConfig(nodes []*Node, services []*Service) (*ConfigDiff, error) {
+	diff := &ConfigDiff{[]string{}, []string{}, []string{}, []string{}, []string{}, []string{}, false}
+	configured := make(map[string]bool)
+	for _, node := range nodes {
+		configured[node.NodeName] = true
+		current, exist := o.node[node.NodeName]
+		switch {
+		case !exist:
+			diff.NodesAdded = append(diff.NodesAdded, node.NodeName)
+		case !reflect.DeepEqual(current.NodeInfo, node.NodeInfo):
+			diff.NodesUpdated = append(diff.NodesUpdated, node.NodeName)
+		}
+	}
+	for name := range o.node {
+		if !configured[name] {
+			diff.NodesRemoved = append(diff.NodesRemoved, name)
+		}
+	}
+	sort.Strings(diff.NodesRemoved)
+	for _, node := range nodes { // nodes are added before removing and updated after removing
+		for name, current := range o.node {
+			if name == node.NodeName || !conflict(node, current) {
+				continue
+			}
+			if _, exist := o.node[node.NodeName]; !exist || configured[name] {
+				return diff, o.Errorf("'%s' node conflicts with registered '%s' node, change them in separate reloads", node.NodeName, name)
+			}
+		}
+	}
+	all := make(map[string]*Service)
+	for _, service := range services {
+		all[service.ServiceName] = service
+		current, exist := o.service[service.ServiceName]
+		if !exist {
+			diff.ServicesAdded = append(diff.ServicesAdded, service.ServiceName)
+			continue
+		}
+		if service.DesiredState == nil && len(current.DesiredState) > 0 { // desired state is managed by reconciler
+			service.DesiredState = make(map[string]string) // if it is not configured, it is kept for configured nodes
+			for _, node := range service.Nodes {
+				if state, exist := current.DesiredState[node.NodeName]; exist {
+					service.DesiredState[node.NodeName] = state
+				}
+			}
+		}
+		if !reflect.DeepEqual(current.ServiceInfo, service.ServiceInfo) || !sameNodes(current.Nodes, service.Nodes) {
+			diff.ServicesUpdated = append(diff.ServicesUpdated, service.ServiceName)
+		}
+	}
+	for name := range o.service {
+		if _, exist := all[name]; !exist {
+			diff.ServicesRemoved = append(diff.ServicesRemoved, name)
+		}
+	}
+	sort.Strings(diff.ServicesRemoved)
+	if err := o.validGraph(all, services...); err != nil {
+		return diff, err
+	}
+	return diff, nil
+}
+
+func sameNodes(a, b []*Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].NodeName != b[i].NodeName {
+			return false
+		}
+	}
+	return true
+}
+
+// applyConfig compares configuration with registered nodes and services and applies changes
+// under one lock: all of them or nothing. Status routines of affected services are restarted
+func (o *Orchestrator) applyConfig(nodes []*Node, services []*Service) (*ConfigDiff, error) {
+	o.mu.Lock()
+	diff, err := o.diffConfig(nodes, services) // checks conflicts of nodes and dependencies of services
+	if err != nil {
+		o.mu.Unlock()
+		return diff, err
+	}
+	byName := make(map[string]*Node)
+	for _, node := range nodes {
+		byName[node.NodeName] = node
+	}
+	service := make(map[string]*Service)
+	for _, s := range services {
+		service[s.ServiceName] = s
+	}
+	for _, s := range services { // services refer only to configured nodes which are kept
+		if err := s.Valid(); err != nil {
+			o.mu.Unlock()
+			return diff, err
+		}
+		for _, node := range s.Nodes {
+			if _, exist := byName[node.NodeName]; !exist {
+				o.mu.Unlock()
+				return diff, o.Errorf("'%s' node is not defined in orchestrator", node.NodeName)
+			}
+		}
+	}
+	// nothing can fail below
+	savedNodes := []*Node{}
+	type nodeChange struct {
+		name         string
+		prev, status NodeState
+	}
+	changes := []nodeChange{}
+	for _, name := range diff.NodesAdded {
+		o.node[name] = byName[name].copy()
+		savedNodes = append(savedNodes, byName[name].copy())
+	}
+	for _, name := range diff.NodesUpdated {
+		prev, status := o.setNodeInfo(o.node[name], byName[name].copy())
+		changes = append(changes, nodeChange{name, prev, status})
+		savedNodes = append(savedNodes, o.node[name].copy())
+	}
+	for _, name := range diff.ServicesRemoved {
+		o.rmService(name)
+	}
+	added, saved := []*Service{}, []*Service{}
+	for _, name := range append(append([]string{}, diff.ServicesAdded...), diff.ServicesUpdated...) {
+		s := service[name].copy()
+		nodes := make([]*Node, len(s.Nodes))
+		for i, node := range s.Nodes {
+			nodes[i] = o.node[node.NodeName]
+		}
+		current, exist := o.service[name]
+		if !exist {
+			current = s
+			o.service[name] = current
+			added = append(added, current)
+		}
+		current.ServiceInfo = s.ServiceInfo
+		current.Nodes = nodes
+		saved = append(saved, current.copy())
+	}
+	for _, name := range diff.NodesRemoved {
+		delete(o.node, name)
+		if client, exist := o.client[name]; exist {
+			client.Close()
+			delete(o.client, name)
+		}
+		delete(o.prober, name)
+	}
+	affected := make(map[string]bool)
+	for _, name := range diff.ServicesUpdated {
+		affected[name] = true
+	}
+	for _, name := range diff.NodesUpdated {
+		for _, s := range services {
+			for _, node := range s.Nodes {
+				affected[s.ServiceName] = affected[s.ServiceName] || node.NodeName == name
+			}
+		}
+	}
+	for _, name := range diff.ServicesAdded {
+		delete(affected, name)
+	}
+	started := o.started
+	o.mu.Unlock()
+
+	for _, node := range savedNodes {
+		o.persist(func(s Storage) error { return s.SaveNode(node) })
+	}
+	for _, change := range changes {
+		o.publishNodeStatus(change.name, change.prev, change.status)
+		o.logf(INFO, "'%s' node has been updated", change.name)
+	}
+	for _, name := range diff.ServicesRemoved {
+		o.rmCheckState(name)
+		o.rmBackoff(name)
+		o.persist(func(s Storage) error { return s.DeleteService(name) })
+		o.logf(INFO, "'%s' service has been deleted from orchestrator", name)
+	}
+	for _, s := range saved {
+		o.persist(func(storage Storage) error { return storage.SaveService(s) })
+	}
+	for _, name := range diff.NodesRemoved {
+		o.persist(func(s Storage) error { return s.DeleteNode(name) })
+		o.logf(INFO, "'%s' node has been deleted from orchestrator", name)
+	}
+	if started {
+		for _, s := range added {
+			go o.ServiceStatusRoutine(s.ServiceName)
+		}
+	}
+	for _, name := range diff.ServicesUpdated {
+		o.logf(INFO, "'%s' service has been updated", name)
+	}
+	for name, restart := range affected {
+		if restart {
+			o.rmCheckState(name)
+			o.rmBackoff(name)
+			o.restartStatusR(name)
+		}
+	}
+	return diff, nil
+}
+
+// conflict returns true if nodes can't be registered together: both are local or have same host
+func conflict(a, b *Node) bool {
+	if a.Connection == nil || b.Connection == nil {
+		return a.Connection == nil && b.Connection == nil
+	}
+	return a.Connection.Host == b.Connection.Host
+}
+
+// ReloadOnSignal reloads configuration on signals (SIGHUP by default) until orchestrator is stopped
+func (o *Orchestrator) ReloadOnSignal(signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, signals...)
+	if !o.spawn(func() {
+		defer signal.Stop(sig)
+		for {
+			select {
+			case <-o.ctx.Done():
+				return
+			case s := <-sig:
+				o.logf(INFO, "%s signal has been received, reloading config", s)
+				o.ReloadConfig(false)
+			}
+		}
+	}) {
+		signal.Stop(sig)
+	}
+}
+
+// WatchConfig reloads configuration when its file is modified, file is checked every interval
+// (DefaultConfigWatchInterval if 0) until orchestrator is stopped
+func (o *Orchestrator) WatchConfig(interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultConfigWatchInterval
+	}
+	o.mu.RLock()
+	path := o.configPath
+	o.mu.RUnlock()
+	if path == "" {
+		return o.Errorf("configuration has not been loaded")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return o.Errorf("%s", err.Error())
+	}
+	modTime, size := info.ModTime(), info.Size()
+	o.spawn(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-o.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				o.logf(WARNING, "'%s' config can't be checked: %s", path, err.Error())
+				continue
+			}
+			if info.ModTime().Equal(modTime) && info.Size() == size {
+				continue
+			}
+			modTime, size = info.ModTime(), info.Size()
+			o.logf(INFO, "'%s' config has been modified, reloading", path)
+			o.ReloadConfig(false)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,108 @@
+package orchestrator
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const (
+	oldConfig = `
+nodes:
+  - nodename: old
+    os: linux
+    connection: {host: 10.0.0.1, port: 22, user: root, sshkey: /tmp/id_rsa}
+services:
+  - servicename: a
+    nodes: [old]
+`
+	newConfig = `
+nodes:
+  - nodename: first
+    os: linux
+    connection: {host: 10.0.0.2, port: 22, user: root, sshkey: /tmp/id_rsa}
+services:
+  - servicename: a
+    nodes: [first]
+`
+)
+
+func TestReloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "orchestrator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfig(t, dir, "config.yaml", oldConfig)
+	o := NewOrchestrator()
+	if _, err := o.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(t, dir, "config.yaml", newConfig)
+	diff, err := o.ReloadConfig(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Applied || diff.String() != "nodes added: first; nodes removed: old; services updated: a" {
+		t.Errorf("dry run diff: %s, applied=%t", diff, diff.Applied)
+	}
+	if _, err := o.GetNode("first"); err == nil {
+		t.Error("dry run has added node")
+	}
+	if diff, err = o.ReloadConfig(false); err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Applied {
+		t.Error("diff is not applied")
+	}
+	if _, err := o.GetNode("old"); err == nil {
+		t.Error("removed node is left")
+	}
+	if service, err := o.GetService("a"); err != nil || len(service.Nodes) != 1 || service.Nodes[0].NodeName != "first" {
+		t.Errorf("service is not moved to new node: %v", err)
+	}
+}
+
+func TestReloadConfigIsAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "orchestrator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfig(t, dir, "config.yaml", oldConfig)
+	o := NewOrchestrator()
+	storage := &blockingStorage{saving: make(chan struct{}), release: make(chan struct{})}
+	if err := o.SetStorage(storage); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(t, dir, "config.yaml", newConfig)
+	reloaded := make(chan error, 1)
+	go func() {
+		_, err := o.ReloadConfig(false)
+		reloaded <- err
+	}()
+	select {
+	case <-storage.saving: // reload is in progress
+	case err := <-reloaded:
+		t.Fatalf("config is not reloaded: %v", err)
+	}
+	old, _ := o.GetNode("old")
+	registered := old != nil && o.RegistrateServices(NewService(&ServiceInfo{ServiceName: "x"}, old)) == nil
+	close(storage.release)
+	err = <-reloaded
+	_, oldErr := o.GetNode("old")
+	_, firstErr := o.GetNode("first")
+	a, _ := o.GetService("a")
+	if err != nil { // nothing is changed
+		if oldErr != nil || firstErr == nil || a.Nodes[0].NodeName != "old" {
+			t.Errorf("config is applied partially: %s", err.Error())
+		}
+		return
+	}
+	if registered || oldErr == nil || firstErr != nil || a.Nodes[0].NodeName != "first" {
+		t.Errorf("config is not applied as a whole, concurrent service is registered: %t", registered)
+	}
+}
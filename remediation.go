@@ -0,0 +1,167 @@
+package orchestrator
+
+import (
+	"fmt"
+	"time"
+)
+
+// RESTART POLICIES
+const (
+	RestartNever     = "never"      // service is never restarted (default)
+	RestartOnFailure = "on-failure" // service is restarted if it has not been stopped by orchestrator
+	RestartAlways    = "always"     // service is restarted even if it has been stopped by orchestrator
+)
+
+// RestartPolicy sets auto-remediation of inactive service on nodes
+type RestartPolicy struct {
+	Policy            string // never / on-failure / always
+	MaxAttempts       int    // maximum attempts inside WindowSeconds, then policy gives up
+	WindowSeconds     int
+	BackoffSeconds    int // initial delay between attempts, doubled on each attempt
+	MaxBackoffSeconds int
+	CooldownSeconds   int // no attempts after policy has given up
+}
+
+type remediationState struct {
+	attempts      []time.Time
+	nextAttempt   time.Time
+	cooldownUntil time.Time
+	inProgress    bool
+	alerted       bool // alert of giving up has been fired, it is resolved on recovery
+	stopped       bool // service has been stopped by orchestrator
+}
+
+func (p *RestartPolicy) Valid() error {
+	switch p.Policy {
+	case "":
+		p.Policy = RestartNever
+	case RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("Restart policy validation: unknown '%s' policy", p.Policy)
+	}
+	if p.MaxAttempts < 0 || p.WindowSeconds < 0 || p.BackoffSeconds < 0 || p.MaxBackoffSeconds < 0 || p.CooldownSeconds < 0 {
+		return fmt.Errorf("Restart policy validation: attempts and intervals must not be negative")
+	}
+	if p.Policy != RestartNever && p.MaxAttempts < 1 {
+		p.MaxAttempts = 3
+	}
+	return nil
+}
+
+func (p *RestartPolicy) backoff(attempt int) time.Duration {
+	backoff := time.Duration(p.BackoffSeconds) * time.Second
+	for i := 1; i < attempt && backoff > 0; i++ {
+		backoff *= 2
+		if p.MaxBackoffSeconds > 0 && backoff > time.Duration(p.MaxBackoffSeconds)*time.Second {
+			return time.Duration(p.MaxBackoffSeconds) * time.Second
+		}
+	}
+	return backoff
+}
+
+// remediationState returns state of service on node, must be called under lock
+func (o *Orchestrator) remediationState(serviceName, nodeName string) *remediationState {
+	key := serviceName + "/" + nodeName
+	state, exist := o.remediation[key]
+	if !exist {
+		state = &remediationState{attempts: []time.Time{}}
+		o.remediation[key] = state
+	}
+	return state
+}
+
+func (o *Orchestrator) setStoppedByOrchestrator(serviceName, nodeName string, stopped bool) {
+	o.mu.Lock()
+	o.remediationState(serviceName, nodeName).stopped = stopped
+	o.mu.Unlock()
+}
+
+// remediate restarts inactive service on nodes according to service's restart policy
+func (o *Orchestrator) remediate(serviceName string, status *ServiceStatusInfo) {
+	service, err := o.GetService(serviceName)
+	if err != nil || service.Restart.Policy == RestartNever || service.Restart.Policy == "" {
+		return
+	}
+	policy := service.Restart
+	now := time.Now()
+	for _, nodeStatus := range status.NodeStatus {
+		nodeName := nodeStatus.NodeName
+		o.mu.Lock()
+		state := o.remediationState(serviceName, nodeName)
+		if nodeStatus.ServiceStatus == ServiceStateActive {
+			recovered := state.alerted
+			state.attempts, state.nextAttempt, state.alerted = []time.Time{}, time.Time{}, false
+			o.mu.Unlock()
+			if recovered {
+				o.fireAlert(remediationAlert(serviceName, nodeName, 0).resolve())
+			}
+			continue
+		}
+		if nodeStatus.ServiceStatus != ServiceStateInactive || state.inProgress ||
+			service.DesiredState[nodeName] == DesiredStopped ||
+			(policy.Policy == RestartOnFailure && state.stopped) ||
+			now.Before(state.cooldownUntil) || now.Before(state.nextAttempt) {
+			o.mu.Unlock()
+			continue
+		}
+		o.mu.Unlock()
+		if o.InMaintenance(serviceName, nodeName) {
+			continue
+		}
+		o.mu.Lock()
+		attempts := []time.Time{}
+		for _, t := range state.attempts {
+			if policy.WindowSeconds < 1 || now.Sub(t) < time.Duration(policy.WindowSeconds)*time.Second {
+				attempts = append(attempts, t)
+			}
+		}
+		state.attempts = attempts
+		if len(attempts) >= policy.MaxAttempts {
+			state.attempts = []time.Time{}
+			state.cooldownUntil = now.Add(time.Duration(policy.CooldownSeconds) * time.Second)
+			o.mu.Unlock()
+			o.publish(Event{Type: EventRemediationGaveUp, Service: serviceName, Node: nodeName,
+				Error: o.Errorf("'%s' service restart has failed %d times on '%s' node", serviceName, len(attempts), nodeName)})
+			alert := remediationAlert(serviceName, nodeName, len(attempts))
+			if o.Suppressed(alert) {
+				continue
+			}
+			o.mu.Lock()
+			state.alerted = true
+			o.mu.Unlock()
+			o.fireAlert(alert)
+			continue
+		}
+		state.attempts = append(state.attempts, now)
+		state.nextAttempt = now.Add(policy.backoff(len(state.attempts)))
+		state.inProgress = true
+		attempt := len(state.attempts)
+		o.mu.Unlock()
+		started := o.spawn(func() {
+			o.logf(WARNING, "'%s' service restart attempt #%d on '%s' node", serviceName, attempt, nodeName)
+			err := o.StartService(nodeName, serviceName)
+			o.mu.Lock()
+			o.remediationState(serviceName, nodeName).inProgress = false
+			o.mu.Unlock()
+			o.publish(Event{Type: EventRemediation, Service: serviceName, Node: nodeName, Error: err})
+		})
+		if !started {
+			o.mu.Lock()
+			state.inProgress = false
+			o.mu.Unlock()
+		}
+	}
+}
+
+func remediationAlert(serviceName, nodeName string, attempts int) *Alert {
+	return &Alert{
+		Key:      "remediation/" + serviceName + "/" + nodeName,
+		Rule:     "remediation",
+		Severity: SeverityCritical,
+		Service:  serviceName,
+		Node:     nodeName,
+		Status:   ServiceStateInactive,
+		Time:     time.Now(),
+		Message:  fmt.Sprintf("'%s' service restart has given up after %d attempts on '%s' node", serviceName, attempts, nodeName),
+	}
+}
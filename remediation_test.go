@@ -0,0 +1,135 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+)
+
+// giveUp makes remediation of inactive service on local node give up, returns types of published events
+func giveUp(t *testing.T, o *Orchestrator) []string {
+	events, cancel := o.Subscribe(&EventFilter{Types: []string{EventRemediation, EventRemediationGaveUp, EventAlertFiring}})
+	defer cancel()
+	status := &ServiceStatusInfo{ServiceStatus: ServiceStateInactive,
+		NodeStatus: []*NodeStatusInfo{{NodeName: "local", NodeStatus: StatusConnected, ServiceStatus: ServiceStateInactive}}}
+	o.remediate("a", status) // restart attempt
+	types := []string{}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			types = append(types, e.Type)
+			switch e.Type {
+			case EventRemediation:
+				o.remediate("a", status) // attempts are exhausted
+			case EventRemediationGaveUp:
+				timeout = time.After(100 * time.Millisecond) // alert is fired after event
+			}
+		case <-timeout:
+			return types
+		}
+	}
+}
+
+func TestRemediationGaveUpAlert(t *testing.T) {
+	defer fakeSystemctl(t)()
+	for _, silenced := range []bool{false, true} {
+		o := NewOrchestrator()
+		if err := o.RegistrateNodes(localNode()); err != nil {
+			t.Fatal(err)
+		}
+		info := &ServiceInfo{ServiceName: "a", Restart: RestartPolicy{Policy: RestartAlways, MaxAttempts: 1, CooldownSeconds: 60}}
+		if err := o.RegistrateServices(NewService(info, localNode())); err != nil {
+			t.Fatal(err)
+		}
+		if silenced {
+			if _, err := o.AddSilence(&Silence{Service: "a", EndsAt: time.Now().Add(time.Hour)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		types := giveUp(t, o)
+		expected := []string{EventRemediation, EventRemediationGaveUp, EventAlertFiring}
+		if silenced {
+			expected = expected[:2]
+		}
+		if len(types) != len(expected) {
+			t.Errorf("silenced=%t: events %v, expected %v", silenced, types, expected)
+		} else {
+			for i := range types {
+				if types[i] != expected[i] {
+					t.Errorf("silenced=%t: events %v, expected %v", silenced, types, expected)
+					break
+				}
+			}
+		}
+		o.Stop()
+	}
+}
+
+func TestRestartPolicyBackoff(t *testing.T) {
+	policy := RestartPolicy{BackoffSeconds: 2, MaxBackoffSeconds: 10}
+	for attempt, expected := range map[int]time.Duration{1: 2 * time.Second, 2: 4 * time.Second, 3: 8 * time.Second, 4: 10 * time.Second} {
+		if backoff := policy.backoff(attempt); backoff != expected {
+			t.Errorf("attempt #%d: backoff %s, expected %s", attempt, backoff, expected)
+		}
+	}
+	if err := (&RestartPolicy{Policy: "sometimes"}).Valid(); err == nil {
+		t.Error("unknown restart policy is valid")
+	}
+}
+
+// restarts returns number of restart attempts of service on local node after inactive status
+func restarts(t *testing.T, o *Orchestrator, serviceName string) int {
+	events, cancel := o.Subscribe(&EventFilter{Services: []string{serviceName}, Types: []string{EventRemediation}})
+	defer cancel()
+	status := &ServiceStatusInfo{ServiceStatus: ServiceStateInactive,
+		NodeStatus: []*NodeStatusInfo{{NodeName: "local", NodeStatus: StatusConnected, ServiceStatus: ServiceStateInactive}}}
+	o.remediate(serviceName, status)
+	n := 0
+	for {
+		select {
+		case e := <-events:
+			if e.Error != nil {
+				t.Errorf("restart of '%s' service has failed: %s", serviceName, e.Error.Error())
+			}
+			n++
+			o.remediate(serviceName, status) // next attempt waits for backoff
+		case <-time.After(200 * time.Millisecond):
+			return n
+		}
+	}
+}
+
+func TestRemediationPolicies(t *testing.T) {
+	defer fakeSystemctl(t)()
+	o := NewOrchestrator()
+	defer o.Stop()
+	if err := o.RegistrateNodes(localNode()); err != nil {
+		t.Fatal(err)
+	}
+	services := map[string]RestartPolicy{
+		"never":      {},
+		"on-failure": {Policy: RestartOnFailure, BackoffSeconds: 60},
+		"stopped":    {Policy: RestartOnFailure, BackoffSeconds: 60},
+		"always":     {Policy: RestartAlways, BackoffSeconds: 60},
+		"desired":    {Policy: RestartAlways, BackoffSeconds: 60},
+	}
+	for name, policy := range services {
+		if err := o.RegistrateServices(NewService(&ServiceInfo{ServiceName: name, Restart: policy, Schedule: Schedule{Interval: -1}}, localNode())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"stopped", "always"} {
+		if err := o.StopService("local", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.SetDesiredState("desired", "local", DesiredStopped); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{"never": 0, "on-failure": 1, "stopped": 0, "always": 1, "desired": 0}
+	for name, n := range expected {
+		if attempts := restarts(t, o, name); attempts != n {
+			t.Errorf("'%s' service is restarted %d times, expected %d", name, attempts, n)
+		}
+	}
+}
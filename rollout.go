@@ -0,0 +1,141 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// JOB TYPES of rollout
+const (
+	JobRollingRestart = "rolling-restart"
+	JobRollingDeploy  = "rolling-deploy"
+)
+
+// DefaultHealthTimeoutSeconds is a time of waiting for restarted nodes to pass health checks
+const DefaultHealthTimeoutSeconds = 60
+
+// RollingPolicy sets rolling restart or deploy over service's nodes
+type RollingPolicy struct {
+	BatchSize            int    // nodes restarted at once, 1 by default
+	MaxUnavailable       int    // maximum unavailable nodes of service including current batch, not limited if 0
+	HealthTimeoutSeconds int    // waiting for batch to pass health checks
+	PauseSeconds         int    // pause between batches
+	Package              string // path to debian package for rolling deploy, restart only if empty
+	PassPhrase           string // pass phrase of ssh key for package installing
+}
+
+func (p *RollingPolicy) Valid() error {
+	if p.BatchSize < 0 || p.MaxUnavailable < 0 || p.HealthTimeoutSeconds < 0 || p.PauseSeconds < 0 {
+		return errors.New("Rolling policy validation: batch size, max unavailable and intervals must not be negative")
+	}
+	if p.BatchSize == 0 {
+		p.BatchSize = 1
+	}
+	if p.MaxUnavailable > 0 && p.BatchSize > p.MaxUnavailable {
+		p.BatchSize = p.MaxUnavailable
+	}
+	if p.HealthTimeoutSeconds == 0 {
+		p.HealthTimeoutSeconds = DefaultHealthTimeoutSeconds
+	}
+	return nil
+}
+
+// Rollout starts rolling restart (or deploy if policy has package) of service as a job,
+// batch of nodes is restarted after the previous one has passed health checks,
+// job stops on the first failure
+func (o *Orchestrator) Rollout(serviceName string, policy RollingPolicy) (*Job, error) {
+	if err := policy.Valid(); err != nil {
+		return nil, err
+	}
+	service, err := o.GetService(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	jobType := JobRollingRestart
+	if policy.Package != "" {
+		jobType = JobRollingDeploy
+	}
+	return o.runJob(jobType, serviceName, func(ctx context.Context, job *Job) error {
+		return o.roll(ctx, job, service, service.Nodes, &policy)
+	}), nil
+}
+
+// roll restarts nodes of service in batches, each batch must pass health checks before the next one
+func (o *Orchestrator) roll(ctx context.Context, job *Job, service *Service, nodes []*Node, policy *RollingPolicy) error {
+	serviceName := service.ServiceName
+	for len(nodes) > 0 {
+		size := policy.BatchSize
+		if size > len(nodes) {
+			size = len(nodes)
+		}
+		if policy.MaxUnavailable > 0 {
+			unavailable := 0
+			for _, node := range service.Nodes {
+				if !inNodes(nodes[:size], node.NodeName) && !o.nodeActive(service, node) {
+					unavailable++
+				}
+			}
+			if size > policy.MaxUnavailable-unavailable {
+				size = policy.MaxUnavailable - unavailable
+			}
+			if size < 1 {
+				return o.Errorf("'%s' service has %d unavailable nodes, max unavailable is %d", serviceName, unavailable, policy.MaxUnavailable)
+			}
+		}
+		batch := nodes[:size]
+		nodes = nodes[size:]
+		for _, node := range batch {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := o.restart(job, node.NodeName, serviceName, policy.Package, policy.PassPhrase); err != nil {
+				return err
+			}
+		}
+		timeout := time.Duration(policy.HealthTimeoutSeconds) * time.Second
+		for _, node := range batch {
+			err := o.waitHealthy(ctx, serviceName, node.NodeName, true, timeout)
+			o.step(job, node.NodeName, "health-check", err)
+			if err != nil {
+				return o.Errorf("'%s' node: %s", node.NodeName, err.Error())
+			}
+		}
+		if len(nodes) > 0 && policy.PauseSeconds > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(policy.PauseSeconds) * time.Second):
+			}
+		}
+	}
+	return nil
+}
+
+// restart installs package (if defined) and restarts service on node recording job steps
+func (o *Orchestrator) restart(job *Job, nodeName, serviceName, packagePath, passPhrase string) error {
+	if packagePath != "" {
+		err := o.InstallPackage(nodeName, packagePath, passPhrase)
+		o.step(job, nodeName, "install", err)
+		if err != nil {
+			return err
+		}
+	}
+	err := o.StopService(nodeName, serviceName)
+	o.step(job, nodeName, "stop", err)
+	if err != nil {
+		return err
+	}
+	err = o.StartService(nodeName, serviceName)
+	o.step(job, nodeName, "start", err)
+	return err
+}
+
+func inNodes(nodes []*Node, nodeName string) bool {
+	for _, node := range nodes {
+		if node.NodeName == nodeName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,346 @@
+package orchestrator
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeSystemctlScript manages units of every node in state directory:
+// unit is active unless it is stopped or broken by bad package, every command is logged
+const fakeSystemctlScript = `state=%s
+command=$1
+shift
+case $command in
+is-active)
+	for unit in "$@"; do
+		if [ -e "$state/$NODE.$unit.stopped" ] || [ -e "$state/$NODE.broken" ]; then echo inactive; else echo active; fi
+	done;;
+start)
+	[ -e "$state/$NODE.fail" ] && exit 1
+	rm -f "$state/$NODE.$1.stopped"
+	echo "$NODE start" >> "$state/log";;
+stop)
+	touch "$state/$NODE.$1.stopped"
+	echo "$NODE stop" >> "$state/log";;
+esac
+`
+
+// fakeDpkgScript installs package on node, package named bad.deb breaks node's units
+const fakeDpkgScript = `state=%s
+echo "$NODE install $(basename $2)" >> "$state/log"
+if [ "$(basename $2)" = bad.deb ]; then touch "$state/$NODE.broken"; else rm -f "$state/$NODE.broken"; fi
+`
+
+// fakeCluster is a set of Linux nodes served by in-process SSH servers,
+// commands of nodes are run by local shell with NODE variable set to node name
+type fakeCluster struct {
+	t        *testing.T
+	state    string // state directory of fake systemctl and dpkg
+	nodes    []*Node
+	packages map[string]string // paths of good.deb and bad.deb
+	close    []func()
+}
+
+func newFakeCluster(t *testing.T, names ...string) *fakeCluster {
+	state, err := ioutil.TempDir("", "orchestrator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &fakeCluster{t: t, state: state, packages: make(map[string]string)}
+	c.close = append(c.close, func() { os.RemoveAll(state) })
+	c.close = append(c.close, fakeCommand(t, "systemctl", fmt.Sprintf(fakeSystemctlScript, state)))
+	c.close = append(c.close, fakeCommand(t, "dpkg", fmt.Sprintf(fakeDpkgScript, state)))
+	for _, name := range []string{"good.deb", "bad.deb"} {
+		c.packages[name] = filepath.Join(state, name)
+		if err := ioutil.WriteFile(c.packages[name], []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(state, "id_rsa")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) { return nil, nil },
+	}
+	config.AddHostKey(signer)
+	for i, name := range names {
+		listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.%d:0", i+2)) // nodes must have different hosts
+		if err != nil {
+			c.Close()
+			t.Fatal(err)
+		}
+		c.close = append(c.close, func() { listener.Close() })
+		go serveSSH(listener, config, name)
+		host, port, _ := net.SplitHostPort(listener.Addr().String())
+		c.nodes = append(c.nodes, NewNode(&NodeInfo{NodeName: name, OS: OSLinux,
+			Connection: &Connection{Host: host, Port: port, User: "test", SSHKey: keyPath}}))
+	}
+	return c
+}
+
+func (c *fakeCluster) Close() {
+	for i := len(c.close) - 1; i >= 0; i-- {
+		c.close[i]()
+	}
+}
+
+// register registers and connects nodes of cluster and service running on them
+func (c *fakeCluster) register(o *Orchestrator, info *ServiceInfo) {
+	if err := o.RegistrateNodes(c.nodes...); err != nil {
+		c.t.Fatal(err)
+	}
+	for _, node := range c.nodes {
+		if err := o.ConnectNode(node.NodeName, ""); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	if err := o.RegistrateServices(NewService(info, c.nodes...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// touch creates state file of fake systemctl, e.g. "n1.fail"
+func (c *fakeCluster) touch(name string) {
+	if err := ioutil.WriteFile(filepath.Join(c.state, name), nil, 0644); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// log returns commands run on nodes
+func (c *fakeCluster) log() []string {
+	data, _ := ioutil.ReadFile(filepath.Join(c.state, "log"))
+	if len(data) == 0 {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func (c *fakeCluster) expectLog(expected ...string) {
+	c.t.Helper()
+	if log := c.log(); strings.Join(log, ";") != strings.Join(expected, ";") {
+		c.t.Errorf("node commands:\n%s\nexpected:\n%s", strings.Join(log, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func serveSSH(listener net.Listener, config *ssh.ServerConfig, nodeName string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, channels, requests, err := ssh.NewServerConn(conn, config)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			go ssh.DiscardRequests(requests)
+			for newChannel := range channels {
+				if newChannel.ChannelType() != "session" {
+					newChannel.Reject(ssh.UnknownChannelType, "session only")
+					continue
+				}
+				channel, requests, err := newChannel.Accept()
+				if err != nil {
+					continue
+				}
+				go serveSession(channel, requests, nodeName)
+			}
+		}()
+	}
+}
+
+// serveSession runs exec request of session, scp upload is accepted and discarded
+func serveSession(channel ssh.Channel, requests <-chan *ssh.Request, nodeName string) {
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var exec struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &exec); err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+		status := runSSHCommand(channel, exec.Command, nodeName)
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+func runSSHCommand(channel ssh.Channel, command, nodeName string) uint32 {
+	if strings.HasPrefix(command, "/usr/bin/scp -t") {
+		io.Copy(ioutil.Discard, channel)
+		return 0
+	}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), "NODE="+nodeName)
+	cmd.Stdout, cmd.Stderr = channel, channel.Stderr()
+	if err := cmd.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			return uint32(exit.ExitCode())
+		}
+		return 127
+	}
+	return 0
+}
+
+// waitJob waits until job is finished
+func waitJob(t *testing.T, o *Orchestrator, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := o.GetJob(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.State != JobRunning {
+			return job
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("job #%s is not finished", id)
+	return nil
+}
+
+func TestRollingRestart(t *testing.T) {
+	cluster := newFakeCluster(t, "n1", "n2", "n3")
+	defer cluster.Close()
+	o := NewOrchestrator()
+	defer o.Stop()
+	cluster.register(o, &ServiceInfo{ServiceName: "s", Schedule: Schedule{Interval: -1}})
+	events, cancel := o.Subscribe(&EventFilter{Types: []string{EventJobFinished}})
+	defer cancel()
+
+	job, err := o.Rollout("s", RollingPolicy{BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Type != JobRollingRestart {
+		t.Errorf("job type is %s, expected %s", job.Type, JobRollingRestart)
+	}
+	job = waitJob(t, o, job.ID)
+	if job.State != JobSucceeded {
+		t.Fatalf("job is %s: %s", job.State, job.Error)
+	}
+	cluster.expectLog("n1 stop", "n1 start", "n2 stop", "n2 start", "n3 stop", "n3 start")
+	actions := []string{}
+	for _, step := range job.Steps {
+		actions = append(actions, step.Node+" "+step.Action)
+	}
+	expected := "n1 stop;n1 start;n2 stop;n2 start;n1 health-check;n2 health-check;n3 stop;n3 start;n3 health-check"
+	if strings.Join(actions, ";") != expected {
+		t.Errorf("job steps are %s, expected %s", strings.Join(actions, ";"), expected)
+	}
+	select {
+	case e := <-events:
+		if e.Service != "s" || e.Error != nil {
+			t.Errorf("unexpected job-finished event of '%s' service: %v", e.Service, e.Error)
+		}
+	case <-time.After(time.Second):
+		t.Error("job-finished event is not published")
+	}
+}
+
+func TestRollingDeployStopsOnFailure(t *testing.T) {
+	cluster := newFakeCluster(t, "n1", "n2", "n3")
+	defer cluster.Close()
+	o := NewOrchestrator()
+	defer o.Stop()
+	cluster.register(o, &ServiceInfo{ServiceName: "s", Schedule: Schedule{Interval: -1}})
+	cluster.touch("n2.fail")
+
+	job, err := o.Rollout("s", RollingPolicy{Package: cluster.packages["good.deb"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitJob(t, o, job.ID)
+	if job.Type != JobRollingDeploy || job.State != JobFailed {
+		t.Fatalf("%s job is %s, expected %s failed", job.Type, job.State, JobRollingDeploy)
+	}
+	cluster.expectLog("n1 install good.deb", "n1 stop", "n1 start", "n2 install good.deb", "n2 stop")
+	if last := job.Steps[len(job.Steps)-1]; last.Node != "n2" || last.Action != "start" || last.Error == "" {
+		t.Errorf("the last step is %s of '%s' node with error '%s', expected failed start of 'n2'", last.Action, last.Node, last.Error)
+	}
+}
+
+func TestRolloutMaxUnavailable(t *testing.T) {
+	cluster := newFakeCluster(t, "n1", "n2", "n3")
+	defer cluster.Close()
+	o := NewOrchestrator()
+	defer o.Stop()
+	cluster.register(o, &ServiceInfo{ServiceName: "s", Schedule: Schedule{Interval: -1}})
+	cluster.touch("n3.s.stopped")
+
+	job, err := o.Rollout("s", RollingPolicy{BatchSize: 2, MaxUnavailable: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitJob(t, o, job.ID)
+	if job.State != JobFailed || len(job.Steps) > 0 {
+		t.Errorf("job is %s after %d steps, expected failed before restart", job.State, len(job.Steps))
+	}
+	if _, err := o.Rollout("s", RollingPolicy{BatchSize: -1}); err == nil {
+		t.Error("rollout with negative batch size is started")
+	}
+	if _, err := o.Rollout("unknown", RollingPolicy{}); err == nil {
+		t.Error("rollout of unknown service is started")
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	cluster := newFakeCluster(t, "n1", "n2")
+	defer cluster.Close()
+	o := NewOrchestrator()
+	defer o.Stop()
+	cluster.register(o, &ServiceInfo{ServiceName: "s", Schedule: Schedule{Interval: -1}})
+
+	job, err := o.Rollout("s", RollingPolicy{PauseSeconds: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for steps := 0; steps < 3; time.Sleep(10 * time.Millisecond) { // the first batch has passed health check
+		current, err := o.GetJob(job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		steps = len(current.Steps)
+	}
+	if err := o.CancelJob(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	job = waitJob(t, o, job.ID)
+	if job.State != JobCancelled {
+		t.Errorf("job is %s, expected %s", job.State, JobCancelled)
+	}
+	cluster.expectLog("n1 stop", "n1 start")
+	if err := o.CancelJob(job.ID); err == nil {
+		t.Error("finished job is cancelled")
+	}
+}
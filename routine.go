@@ -0,0 +1,119 @@
+package orchestrator
+
+import "time"
+
+type statusRoutine struct {
+	paused    bool
+	cancel    func()
+	wake      chan bool // true -- check status now, false -- reschedule only
+	lastCheck time.Time
+	nextCheck time.Time
+}
+
+// RoutineInfo describes status routine of service
+type RoutineInfo struct {
+	ServiceName string
+	Paused      bool
+	LastCheck   time.Time
+	NextCheck   time.Time // zero if routine is paused or status is checked on demand only
+}
+
+func (r *statusRoutine) wakeUp(check bool) {
+	for {
+		select {
+		case r.wake <- check:
+			return
+		default: // already woken up, requests are merged
+		}
+		select {
+		case pending := <-r.wake:
+			check = check || pending
+		default:
+		}
+	}
+}
+
+// StatusRoutines returns running status routines
+func (o *Orchestrator) StatusRoutines() []*RoutineInfo {
+	o.mu.RLock()
+	routines := []*RoutineInfo{}
+	for name, routine := range o.routine {
+		routines = append(routines, &RoutineInfo{name, routine.paused, routine.lastCheck, routine.nextCheck})
+	}
+	o.mu.RUnlock()
+	return routines
+}
+
+// PauseStatusRoutine stops periodic status checks of service, status still can be triggered
+func (o *Orchestrator) PauseStatusRoutine(serviceName string) error {
+	return o.setPaused(serviceName, true)
+}
+
+// ResumeStatusRoutine restarts periodic status checks of service
+func (o *Orchestrator) ResumeStatusRoutine(serviceName string) error {
+	return o.setPaused(serviceName, false)
+}
+
+// TriggerStatusCheck checks service status immediately
+func (o *Orchestrator) TriggerStatusCheck(serviceName string) error {
+	o.mu.RLock()
+	routine, exist := o.routine[serviceName]
+	o.mu.RUnlock()
+	if !exist {
+		return o.Errorf("'%s' service has no status routine", serviceName)
+	}
+	routine.wakeUp(true)
+	return nil
+}
+
+func (o *Orchestrator) setPaused(serviceName string, paused bool) error {
+	o.mu.Lock()
+	routine, exist := o.routine[serviceName]
+	if !exist {
+		o.mu.Unlock()
+		return o.Errorf("'%s' service has no status routine", serviceName)
+	}
+	routine.paused = paused
+	o.mu.Unlock()
+	routine.wakeUp(false)
+	if paused {
+		o.logf(INFO, "'%s' service status routine has been paused", serviceName)
+	} else {
+		o.logf(INFO, "'%s' service status routine has been resumed", serviceName)
+	}
+	return nil
+}
+
+// reschedule applies changed interval of service's status routine
+func (o *Orchestrator) reschedule(serviceName string) {
+	o.mu.RLock()
+	routine, exist := o.routine[serviceName]
+	o.mu.RUnlock()
+	if exist {
+		routine.wakeUp(false)
+	}
+}
+
+// restartStatusR restarts status routine of service to apply its changed settings,
+// paused routine stays paused
+func (o *Orchestrator) restartStatusR(serviceName string) {
+	o.mu.Lock()
+	paused := false
+	if routine, exist := o.routine[serviceName]; exist {
+		paused = routine.paused
+	}
+	o.stopStatusR(serviceName)
+	started := o.started
+	o.mu.Unlock()
+	if started {
+		go o.runStatusR(serviceName, paused)
+	}
+}
+
+// stopStatusR stops status routine of removed service, must be called under lock
+func (o *Orchestrator) stopStatusR(serviceName string) {
+	if routine, exist := o.routine[serviceName]; exist {
+		routine.cancel()
+		delete(o.routine, serviceName)
+	}
+}
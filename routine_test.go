@@ -0,0 +1,43 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestartStatusRoutineKeepsPaused(t *testing.T) {
+	defer fakeSystemctl(t)()
+	o := startOrchestrator(t)
+	defer o.Stop()
+	if err := o.RegistrateServices(NewService(&ServiceInfo{ServiceName: "a", TimeoutSeconds: 60}, localNode())); err != nil {
+		t.Fatal(err)
+	}
+	routine := waitStatusR(t, o, "a", nil)
+	if err := o.PauseStatusRoutine("a"); err != nil {
+		t.Fatal(err)
+	}
+	o.restartStatusR("a")
+	restarted := waitStatusR(t, o, "a", routine)
+	o.mu.RLock()
+	paused := restarted.paused
+	o.mu.RUnlock()
+	if !paused {
+		t.Error("paused status routine is resumed by restart")
+	}
+}
+
+// waitStatusR waits until status routine of service is started and differs from previous one
+func waitStatusR(t *testing.T, o *Orchestrator, serviceName string, previous *statusRoutine) *statusRoutine {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		o.mu.RLock()
+		routine, exist := o.routine[serviceName]
+		o.mu.RUnlock()
+		if exist && routine != previous {
+			return routine
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("'%s' service status routine is not started", serviceName)
+	return nil
+}
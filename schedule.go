@@ -0,0 +1,179 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// DEFAULT SCHEDULE
+const (
+	DefaultScheduleInterval = 10 * time.Second
+	DefaultScheduleJitter   = 0.1 // 10% of interval
+	DefaultCheckTimeout     = 10 * time.Second
+	DefaultMaxBackoff       = 5 * time.Minute
+	MinScheduleInterval     = 100 * time.Millisecond // shorter periodic checks are rejected
+)
+
+// Duration is time.Duration which is encoded as string like "1m30s" or "500ms",
+// number is decoded as seconds
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) { return json.Marshal(time.Duration(d).String()) }
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	case string:
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(duration)
+	default:
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+	return nil
+}
+
+// Schedule defines how often and how long service status is checked
+type Schedule struct {
+	Interval   Duration // period of status checks, TimeoutSeconds or DefaultScheduleInterval if 0, on demand only if negative
+	Jitter     float64  // random spread of interval as a fraction up to 1, DefaultScheduleJitter if 0, no jitter if negative
+	Timeout    Duration // waiting for one check of node or http access, DefaultCheckTimeout if 0
+	MaxBackoff Duration // max period of polling unreachable nodes, DefaultMaxBackoff if 0, no backoff if negative
+}
+
+func (s *Schedule) Valid() error {
+	if s.Interval > 0 && time.Duration(s.Interval) < MinScheduleInterval {
+		return fmt.Errorf("Schedule validation: interval must not be less than %s", MinScheduleInterval)
+	}
+	if s.Jitter > 1 {
+		return fmt.Errorf("Schedule validation: jitter must not be greater than 1")
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("Schedule validation: timeout must not be negative")
+	}
+	return nil
+}
+
+// interval returns period of status checks of service, false if status is checked on demand only
+func (s *ServiceInfo) interval() (time.Duration, bool) {
+	switch {
+	case s.Schedule.Interval < 0:
+		return 0, false
+	case s.Schedule.Interval > 0:
+		return time.Duration(s.Schedule.Interval), true
+	case s.TimeoutSeconds > 0:
+		return time.Duration(s.TimeoutSeconds) * time.Second, true
+	}
+	return DefaultScheduleInterval, true
+}
+
+// jitter returns interval randomly spread by jitter, so routines started together are not phase-locked
+func (s *Schedule) jitter(interval time.Duration) time.Duration {
+	jitter := s.fraction()
+	return interval + time.Duration((rand.Float64()*2-1)*jitter*float64(interval))
+}
+
+// splay returns random delay of the first check
+func (s *Schedule) splay(interval time.Duration) time.Duration {
+	jitter := s.fraction()
+	return time.Duration(rand.Float64() * jitter * float64(interval))
+}
+
+// fraction returns random spread of interval, 0 if jitter is disabled
+func (s *Schedule) fraction() float64 {
+	switch {
+	case s.Jitter < 0:
+		return 0
+	case s.Jitter == 0:
+		return DefaultScheduleJitter
+	}
+	return s.Jitter
+}
+
+func (s *Schedule) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return time.Duration(s.Timeout)
+	}
+	return DefaultCheckTimeout
+}
+
+// backoff returns period of polling node after failures in a row
+func (s *Schedule) backoff(interval time.Duration, failures int) time.Duration {
+	max := time.Duration(s.MaxBackoff)
+	if max < 0 || failures < 1 {
+		return 0
+	}
+	if max == 0 {
+		max = DefaultMaxBackoff
+	}
+	backoff := interval
+	for i := 0; i < failures && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// nodeBackoff keeps last result of unreachable node which is polled slower
+type nodeBackoff struct {
+	failures int
+	next     time.Time
+	last     NodeStatusInfo
+}
+
+// backedOff returns last status of node if it must not be probed yet
+func (o *Orchestrator) backedOff(serviceName, nodeName string) (*NodeStatusInfo, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	state, exist := o.backoff[serviceName+"/"+nodeName]
+	if !exist || time.Now().After(state.next) {
+		return nil, false
+	}
+	last := state.last
+	return &last, true
+}
+
+// backOff updates backoff state of node by result of probe
+func (o *Orchestrator) backOff(service *Service, status *NodeStatusInfo) {
+	key := service.ServiceName + "/" + status.NodeName
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if status.ServiceStatus != ServiceStateUnreachable {
+		delete(o.backoff, key)
+		return
+	}
+	state, exist := o.backoff[key]
+	if !exist {
+		state = &nodeBackoff{}
+		o.backoff[key] = state
+	}
+	state.failures++
+	state.last = *status
+	interval, periodic := service.interval()
+	if !periodic {
+		interval = DefaultScheduleInterval
+	}
+	state.next = time.Now().Add(service.Schedule.backoff(interval, state.failures))
+}
+
+func (o *Orchestrator) rmBackoff(serviceName string) {
+	o.mu.Lock()
+	for key := range o.backoff {
+		if strings.HasPrefix(key, serviceName+"/") {
+			delete(o.backoff, key)
+		}
+	}
+	o.mu.Unlock()
+}
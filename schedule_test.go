@@ -0,0 +1,53 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleValid(t *testing.T) {
+	tests := []struct {
+		schedule Schedule
+		valid    bool
+	}{
+		{Schedule{}, true},
+		{Schedule{Interval: Duration(time.Nanosecond)}, false},
+		{Schedule{Interval: Duration(MinScheduleInterval - 1)}, false},
+		{Schedule{Interval: Duration(MinScheduleInterval)}, true},
+		{Schedule{Interval: -1}, true},
+		{Schedule{Jitter: -1}, true},
+		{Schedule{Jitter: 1}, true},
+		{Schedule{Jitter: 1.5}, false},
+		{Schedule{Timeout: -1}, false},
+	}
+	for _, test := range tests {
+		if err := test.schedule.Valid(); (err == nil) != test.valid {
+			t.Errorf("%+v: error=%v, expected valid=%t", test.schedule, err, test.valid)
+		}
+	}
+}
+
+func TestScheduleJitter(t *testing.T) {
+	interval := time.Second
+	disabled := Schedule{Jitter: -1}
+	for i := 0; i < 100; i++ {
+		if delay := disabled.jitter(interval); delay != interval {
+			t.Fatalf("disabled jitter: delay=%s, expected %s", delay, interval)
+		}
+		if delay := disabled.splay(interval); delay != 0 {
+			t.Fatalf("disabled jitter: splay=%s, expected 0", delay)
+		}
+	}
+	spread := time.Duration(DefaultScheduleJitter * float64(interval))
+	var jittered bool
+	for i := 0; i < 100; i++ {
+		delay := (&Schedule{}).jitter(interval)
+		if delay < interval-spread || delay > interval+spread {
+			t.Fatalf("default jitter: delay=%s, expected %s±%s", delay, interval, spread)
+		}
+		jittered = jittered || delay != interval
+	}
+	if !jittered {
+		t.Errorf("default jitter: delay is never spread")
+	}
+}
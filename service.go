@@ -18,21 +18,37 @@ type ServiceInfo struct {
 	ServiceName    string
 	URL            string
 	HTTPAccess     []*HTTPAccess // http access settings
-	TimeoutSeconds int           // seconds
+	TimeoutSeconds int           // interval of status checks in seconds, used if Schedule.Interval is 0
+	Schedule       Schedule      // interval, jitter, per-check timeout & backoff of status checks
+	NodeCheck      CheckPolicy   // thresholds of service status check on nodes
+	FlapDetection  FlapDetection
+	Aggregation    Aggregation       // multi-node service status policy
+	Restart        RestartPolicy     // auto-remediation of inactive service
+	DesiredState   map[string]string // running / stopped by node name, managed by reconciler
+	DependsOn      []Dependency      // services which must be healthy before service is started
+}
+
+// Aggregation defines when multi-node service is active
+type Aggregation struct {
+	Policy     string // any / all / quorum / at-least / percentage
+	Nodes      int    // for at-least policy
+	Percentage int    // for percentage policy
 }
 
 type ServiceStatusInfo struct {
-	ServiceStatus    int
-	HTTPAccessStatus int
+	ServiceStatus    ServiceState
+	HTTPAccessStatus CheckState
 	NodeStatus       []*NodeStatusInfo
 	ThisUpdate       time.Time
 	NextUpdate       time.Time
+	Flapping         bool
 }
 
 type NodeStatusInfo struct {
 	NodeName      string
-	NodeStatus    int
-	ServiceStatus int
+	NodeStatus    NodeState
+	ServiceStatus ServiceState
+	ExitCode      int // result of status command on node, synthetic for batched command: as if service is checked alone
 }
 
 // HTTPAccess smth like in consul config
@@ -41,6 +57,7 @@ type HTTPAccess struct {
 	Address    string
 	StatusCode int
 	Headers    map[string]string
+	CheckPolicy
 }
 
 type StatusDetail struct {
@@ -55,14 +72,57 @@ type StatusInfo struct {
 }
 
 func NewService(config *ServiceInfo, nodes ...*Node) *Service {
-	return &Service{ServiceStatusInfo{StatusInitialized, StatusInitialized, []*NodeStatusInfo{}, time.Now(), time.Time{}}, *config, nodes}
+	return &Service{ServiceStatusInfo{StatusInitialized, StatusInitialized, []*NodeStatusInfo{}, time.Now(), time.Time{}, false}, *config, nodes}
 }
 
 func (s *Service) Status() *ServiceStatusInfo {
-	status := s.ServiceStatus
+	status := s.ServiceStatus.copy()
 	return &status
 }
 
+// copy returns deep copy of service, nothing is shared with the original
+func (s *Service) copy() *Service {
+	cp := &Service{s.ServiceStatus.copy(), s.ServiceInfo.copy(), make([]*Node, len(s.Nodes))}
+	for i, node := range s.Nodes {
+		cp.Nodes[i] = node.copy()
+	}
+	return cp
+}
+
+// copy returns deep copy of service settings
+func (s *ServiceInfo) copy() ServiceInfo {
+	cp := *s
+	if s.HTTPAccess != nil {
+		cp.HTTPAccess = make([]*HTTPAccess, len(s.HTTPAccess))
+		for i, access := range s.HTTPAccess {
+			cp.HTTPAccess[i] = access.copy()
+		}
+	}
+	if s.DesiredState != nil {
+		cp.DesiredState = make(map[string]string, len(s.DesiredState))
+		for node, state := range s.DesiredState {
+			cp.DesiredState[node] = state
+		}
+	}
+	if s.DependsOn != nil {
+		cp.DependsOn = append([]Dependency{}, s.DependsOn...)
+	}
+	return cp
+}
+
+// copy returns deep copy of status
+func (s *ServiceStatusInfo) copy() ServiceStatusInfo {
+	cp := *s
+	if s.NodeStatus != nil {
+		cp.NodeStatus = make([]*NodeStatusInfo, len(s.NodeStatus))
+		for i, status := range s.NodeStatus {
+			n := *status
+			cp.NodeStatus[i] = &n
+		}
+	}
+	return cp
+}
+
 func (s *Service) SetNode(node *Node) error {
 	if s.Nodes == nil || len(s.Nodes) < 1 {
 		var nodes []*Node
@@ -90,11 +150,43 @@ func (s *Service) Valid() error {
 	if s.TimeoutSeconds < 1 {
 		s.TimeoutSeconds = 0
 	}
+	if err := s.Schedule.Valid(); err != nil {
+		return err
+	}
 	for _, node := range s.Nodes {
 		if err := node.Valid(); err != nil {
 			return fmt.Errorf("Service validation: '%s' node is not valid: %s", node.NodeName, err.Error())
 		}
 	}
+	for nodeName, state := range s.DesiredState {
+		if state != DesiredRunning && state != DesiredStopped {
+			return fmt.Errorf("Service validation: unknown '%s' desired state of '%s' node", state, nodeName)
+		}
+		found := false
+		for _, node := range s.Nodes {
+			found = found || node.NodeName == nodeName
+		}
+		if !found {
+			return fmt.Errorf("Service validation: desired state is set for '%s' node which is not a node of '%s' service", nodeName, s.ServiceName)
+		}
+	}
+	for i := range s.DependsOn {
+		if err := s.DependsOn[i].Valid(); err != nil {
+			return err
+		}
+	}
+	if err := s.Aggregation.Valid(len(s.Nodes)); err != nil {
+		return err
+	}
+	if err := s.Restart.Valid(); err != nil {
+		return err
+	}
+	if err := s.NodeCheck.Valid(); err != nil {
+		return err
+	}
+	if err := s.FlapDetection.Valid(); err != nil {
+		return err
+	}
 	for _, hAccess := range s.HTTPAccess {
 		if err := hAccess.Valid(); err != nil {
 			return err
@@ -103,6 +195,58 @@ func (s *Service) Valid() error {
 	return nil
 }
 
+func (a *Aggregation) Valid(nodes int) error {
+	switch a.Policy {
+	case "":
+		a.Policy = AggregationAny
+	case AggregationAny, AggregationAll, AggregationQuorum:
+	case AggregationAtLeast:
+		if a.Nodes < 1 || a.Nodes > nodes {
+			return fmt.Errorf("Aggregation validation: '%s' policy requires from 1 to %d nodes", a.Policy, nodes)
+		}
+	case AggregationPercentage:
+		if a.Percentage < 1 || a.Percentage > 100 {
+			return fmt.Errorf("Aggregation validation: '%s' policy requires percentage from 1 to 100", a.Policy)
+		}
+	default:
+		return fmt.Errorf("Aggregation validation: unknown '%s' policy", a.Policy)
+	}
+	return nil
+}
+
+// Satisfied returns true if number of active nodes from total meets the policy
+func (a *Aggregation) Satisfied(active, total int) bool {
+	if total < 1 {
+		return false
+	}
+	switch a.Policy {
+	case AggregationAll:
+		return active == total
+	case AggregationQuorum:
+		return active > total/2
+	case AggregationAtLeast:
+		return active >= a.Nodes
+	case AggregationPercentage:
+		return active*100 >= a.Percentage*total
+	}
+	return active > 0
+}
+
+// Aggregate returns service status by number of active nodes from total: active if all nodes are active,
+// degraded if some nodes are active and policy is satisfied, inactive otherwise
+func (a *Aggregation) Aggregate(active, total int) ServiceState {
+	if total < 1 {
+		return StatusUndefined
+	}
+	if active == total {
+		return StatusActive
+	}
+	if active > 0 && a.Satisfied(active, total) {
+		return StatusDegraded
+	}
+	return StatusInactive
+}
+
 func (h *HTTPAccess) Valid() error {
 	_, ok := HttpMethodMap[h.Method]
 	if !ok {
@@ -115,10 +259,39 @@ func (h *HTTPAccess) Valid() error {
 	if h.StatusCode < 100 || h.StatusCode > 526 {
 		return errors.New("HTTPAccess validation: unknown status code")
 	}
-	return nil
+	return h.CheckPolicy.Valid()
+}
+
+// Check runs http access with retries
+func (h *HTTPAccess) Check() error {
+	return h.check(0)
+}
+
+// check runs http access with retries, each attempt is limited by timeout
+func (h *HTTPAccess) check(timeout time.Duration) error {
+	return h.CheckPolicy.retry(func() error { return h.do(timeout) })
+}
+
+func (h *HTTPAccess) copy() *HTTPAccess {
+	cp := *h
+	if h.Headers != nil {
+		cp.Headers = make(map[string]string, len(h.Headers))
+		for key, value := range h.Headers {
+			cp.Headers[key] = value
+		}
+	}
+	return &cp
+}
+
+func (h *HTTPAccess) String() string {
+	return h.Method + " " + h.Address
 }
 
 func (h *HTTPAccess) Do() error {
+	return h.do(0)
+}
+
+func (h *HTTPAccess) do(timeout time.Duration) error {
 	request, err := http.NewRequest(h.Method, h.Address, nil)
 	if err != nil {
 		return fmt.Errorf("HTTP access method: %s", err.Error())
@@ -128,11 +301,12 @@ func (h *HTTPAccess) Do() error {
 			request.Header.Set(key, value)
 		}
 	}
-	client := new(http.Client)
+	client := &http.Client{Timeout: timeout}
 	resp, err := client.Do(request)
 	if err != nil {
 		return fmt.Errorf("HTTP access method: %s", err.Error())
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != h.StatusCode {
 		return fmt.Errorf("HTTP access method: expected status '%d', got '%d'", h.StatusCode, resp.StatusCode)
 	}
@@ -0,0 +1,38 @@
+package orchestrator
+
+import "testing"
+
+func TestAggregation(t *testing.T) {
+	tests := []struct {
+		aggregation Aggregation
+		active      int
+		total       int
+		status      ServiceState
+		satisfied   bool
+	}{
+		{Aggregation{Policy: AggregationAny}, 5, 5, StatusActive, true},
+		{Aggregation{Policy: AggregationAny}, 1, 5, StatusDegraded, true},
+		{Aggregation{Policy: AggregationAny}, 0, 5, StatusInactive, false},
+		{Aggregation{Policy: AggregationAll}, 5, 5, StatusActive, true},
+		{Aggregation{Policy: AggregationAll}, 4, 5, StatusInactive, false},
+		{Aggregation{Policy: AggregationAll}, 1, 5, StatusInactive, false},
+		{Aggregation{Policy: AggregationAll}, 0, 5, StatusInactive, false},
+		{Aggregation{Policy: AggregationQuorum}, 3, 5, StatusDegraded, true},
+		{Aggregation{Policy: AggregationQuorum}, 2, 5, StatusInactive, false},
+		{Aggregation{Policy: AggregationAtLeast, Nodes: 2}, 2, 5, StatusDegraded, true},
+		{Aggregation{Policy: AggregationAtLeast, Nodes: 2}, 1, 5, StatusInactive, false},
+		{Aggregation{Policy: AggregationPercentage, Percentage: 60}, 3, 5, StatusDegraded, true},
+		{Aggregation{Policy: AggregationPercentage, Percentage: 60}, 2, 5, StatusInactive, false},
+		{Aggregation{Policy: AggregationAny}, 0, 0, StatusUndefined, false},
+	}
+	for _, test := range tests {
+		if status := test.aggregation.Aggregate(test.active, test.total); status != test.status {
+			t.Errorf("%s policy: %d of %d active nodes: status=%s, expected %s",
+				test.aggregation.Policy, test.active, test.total, status, test.status)
+		}
+		if satisfied := test.aggregation.Satisfied(test.active, test.total); satisfied != test.satisfied {
+			t.Errorf("%s policy: %d of %d active nodes: satisfied=%t, expected %t",
+				test.aggregation.Policy, test.active, test.total, satisfied, test.satisfied)
+		}
+	}
+}
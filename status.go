@@ -0,0 +1,121 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// NodeState is a state of node connection
+type NodeState int
+
+// ServiceState is a state of service (in total or on a single node)
+type ServiceState int
+
+// CheckState is a state of service check (HTTP access)
+type CheckState int
+
+const (
+	NodeStateInitialized  NodeState = StatusInitialized
+	NodeStateUndefined    NodeState = StatusUndefined
+	NodeStateConnected    NodeState = StatusConnected
+	NodeStateDisconnected NodeState = StatusDisconnected
+
+	ServiceStateInitialized ServiceState = StatusInitialized
+	ServiceStateUndefined   ServiceState = StatusUndefined
+	ServiceStateActive      ServiceState = StatusActive
+	ServiceStateInactive    ServiceState = StatusInactive
+	ServiceStateDegraded    ServiceState = StatusDegraded
+	ServiceStateUnreachable ServiceState = StatusUnreachable
+	ServiceStateUnknownOS   ServiceState = StatusUnknownOS
+
+	CheckStateInitialized CheckState = StatusInitialized
+	CheckStateUndefined   CheckState = StatusUndefined
+	CheckStatePassed      CheckState = StatusPassed
+	CheckStateFailed      CheckState = StatusFailed
+)
+
+var nodeStateNames = map[int]string{
+	StatusInitialized:  "initialized",
+	StatusUndefined:    "undefined",
+	StatusConnected:    "connected",
+	StatusDisconnected: "disconnected",
+}
+
+var serviceStateNames = map[int]string{
+	StatusInitialized: "initialized",
+	StatusUndefined:   "undefined",
+	StatusActive:      "active",
+	StatusInactive:    "inactive",
+	StatusDegraded:    "degraded",
+	StatusUnreachable: "unreachable",
+	StatusUnknownOS:   "unknown-os",
+}
+
+var checkStateNames = map[int]string{
+	StatusInitialized: "initialized",
+	StatusUndefined:   "undefined",
+	StatusPassed:      "passed",
+	StatusFailed:      "failed",
+}
+
+func (s NodeState) Code() int { return int(s) }
+
+func (s NodeState) String() string { return stateString(int(s), nodeStateNames) }
+
+func (s NodeState) MarshalJSON() ([]byte, error) { return json.Marshal(s.String()) }
+
+func (s *NodeState) UnmarshalJSON(data []byte) error {
+	code, err := parseState(data, nodeStateNames)
+	*s = NodeState(code)
+	return err
+}
+
+func (s ServiceState) Code() int { return int(s) }
+
+func (s ServiceState) String() string { return stateString(int(s), serviceStateNames) }
+
+func (s ServiceState) MarshalJSON() ([]byte, error) { return json.Marshal(s.String()) }
+
+func (s *ServiceState) UnmarshalJSON(data []byte) error {
+	code, err := parseState(data, serviceStateNames)
+	*s = ServiceState(code)
+	return err
+}
+
+func (s CheckState) Code() int { return int(s) }
+
+func (s CheckState) String() string { return stateString(int(s), checkStateNames) }
+
+func (s CheckState) MarshalJSON() ([]byte, error) { return json.Marshal(s.String()) }
+
+func (s *CheckState) UnmarshalJSON(data []byte) error {
+	code, err := parseState(data, checkStateNames)
+	*s = CheckState(code)
+	return err
+}
+
+func stateString(code int, names map[int]string) string {
+	if name, ok := names[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", code)
+}
+
+// parseState accepts readable name as well as numeric code for compatibility
+func parseState(data []byte, names map[int]string) (int, error) {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		code, err := strconv.Atoi(string(data))
+		if err != nil {
+			return StatusUndefined, fmt.Errorf("Status: can't parse '%s'", string(data))
+		}
+		return code, nil
+	}
+	for code, n := range names {
+		if n == name {
+			return code, nil
+		}
+	}
+	return StatusUndefined, fmt.Errorf("Status: unknown '%s' status", name)
+}
@@ -0,0 +1,329 @@
+package orchestrator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Storage persists orchestrator's registry, status snapshots and events
+type Storage interface {
+	SaveNode(node *Node) error
+	DeleteNode(nodeName string) error
+	SaveService(service *Service) error
+	DeleteService(serviceName string) error
+	SaveStatus(serviceName string, status *ServiceStatusInfo) error
+	SaveEvent(event *EventRecord) error
+	Load() (*StorageState, error)
+	Close() error
+}
+
+// StorageState is everything restored from storage
+type StorageState struct {
+	Nodes    []*Node
+	Services []*Service
+	Statuses map[string][]*ServiceStatusInfo // ordered status snapshots per service
+	Events   []*EventRecord
+}
+
+// EventRecord is a serializable Event
+type EventRecord struct {
+	ID      uint64
+	Type    string
+	Time    time.Time
+	Service string
+	Node    string             `json:",omitempty"`
+	From    *ServiceState      `json:",omitempty"` // status-changed event only
+	To      *ServiceState      `json:",omitempty"` // status-changed event only
+	Status  *ServiceStatusInfo `json:",omitempty"` // status events only
+	Alert   *Alert             `json:",omitempty"` // alert events only
+	Error   string             `json:",omitempty"`
+}
+
+const (
+	recordNode          = "node"
+	recordNodeDelete    = "node-delete"
+	recordService       = "service"
+	recordServiceDelete = "service-delete"
+	recordStatus        = "status"
+	recordEvent         = "event"
+)
+
+type storageRecord struct {
+	Type    string
+	Time    time.Time
+	Name    string             `json:",omitempty"`
+	Node    *Node              `json:",omitempty"`
+	Service *Service           `json:",omitempty"`
+	Status  *ServiceStatusInfo `json:",omitempty"`
+	Event   *EventRecord       `json:",omitempty"`
+}
+
+// FileStorage is an append-only JSON log, one record per line,
+// the log is compacted on Load
+type FileStorage struct {
+	path  string
+	limit int // maximum number of status snapshots per service and of events
+	file  *os.File
+	mux   sync.Mutex
+}
+
+func NewFileStorage(path string, limit int) (*FileStorage, error) {
+	if limit < 1 {
+		limit = DefaultHistoryLimit
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Storage: %s", err.Error())
+	}
+	return &FileStorage{path, limit, file, sync.Mutex{}}, nil
+}
+
+func (f *FileStorage) SaveNode(node *Node) error {
+	return f.append(&storageRecord{Type: recordNode, Name: node.NodeName, Node: node})
+}
+
+func (f *FileStorage) DeleteNode(nodeName string) error {
+	return f.append(&storageRecord{Type: recordNodeDelete, Name: nodeName})
+}
+
+func (f *FileStorage) SaveService(service *Service) error {
+	return f.append(&storageRecord{Type: recordService, Name: service.ServiceName, Service: service})
+}
+
+func (f *FileStorage) DeleteService(serviceName string) error {
+	return f.append(&storageRecord{Type: recordServiceDelete, Name: serviceName})
+}
+
+func (f *FileStorage) SaveStatus(serviceName string, status *ServiceStatusInfo) error {
+	return f.append(&storageRecord{Type: recordStatus, Name: serviceName, Status: status})
+}
+
+func (f *FileStorage) SaveEvent(event *EventRecord) error {
+	return f.append(&storageRecord{Type: recordEvent, Name: event.Service, Event: event})
+}
+
+// Close syncs appended records to disk and closes the log
+func (f *FileStorage) Close() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return fmt.Errorf("Storage: %s", err.Error())
+	}
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("Storage: %s", err.Error())
+	}
+	return nil
+}
+
+func (f *FileStorage) append(record *storageRecord) error {
+	record.Time = time.Now()
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("Storage: %s", err.Error())
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if _, err := f.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("Storage: %s", err.Error())
+	}
+	return nil
+}
+
+// Load replays the log and rewrites it in compacted form
+func (f *FileStorage) Load() (*StorageState, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("Storage: %s", err.Error())
+	}
+	nodes, nodeNames := make(map[string]*Node), []string{}
+	services, serviceNames := make(map[string]*Service), []string{}
+	state := &StorageState{[]*Node{}, []*Service{}, make(map[string][]*ServiceStatusInfo), []*EventRecord{}}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		record := new(storageRecord)
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("Storage: %s:%d: %s", f.path, line, err.Error())
+		}
+		switch record.Type {
+		case recordNode:
+			if _, exist := nodes[record.Name]; !exist {
+				nodeNames = append(nodeNames, record.Name)
+			}
+			nodes[record.Name] = record.Node
+		case recordNodeDelete:
+			delete(nodes, record.Name)
+			nodeNames = remove(nodeNames, record.Name)
+		case recordService:
+			if _, exist := services[record.Name]; !exist {
+				serviceNames = append(serviceNames, record.Name)
+			}
+			services[record.Name] = record.Service
+		case recordServiceDelete:
+			delete(services, record.Name)
+			delete(state.Statuses, record.Name)
+			serviceNames = remove(serviceNames, record.Name)
+		case recordStatus:
+			statuses := append(state.Statuses[record.Name], record.Status)
+			if len(statuses) > f.limit {
+				statuses = statuses[len(statuses)-f.limit:]
+			}
+			state.Statuses[record.Name] = statuses
+		case recordEvent:
+			state.Events = append(state.Events, record.Event)
+			if len(state.Events) > f.limit {
+				state.Events = state.Events[len(state.Events)-f.limit:]
+			}
+		}
+	}
+	file.Close()
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Storage: %s", err.Error())
+	}
+	for _, name := range nodeNames {
+		state.Nodes = append(state.Nodes, nodes[name])
+	}
+	for _, name := range serviceNames {
+		state.Services = append(state.Services, services[name])
+	}
+	return state, f.compact(state)
+}
+
+// compact rewrites log with state, must be called under lock
+func (f *FileStorage) compact(state *StorageState) error {
+	tmp := f.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Storage: %s", err.Error())
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	records := []*storageRecord{}
+	now := time.Now()
+	for _, node := range state.Nodes {
+		records = append(records, &storageRecord{Type: recordNode, Time: now, Name: node.NodeName, Node: node})
+	}
+	for _, service := range state.Services {
+		records = append(records, &storageRecord{Type: recordService, Time: now, Name: service.ServiceName, Service: service})
+	}
+	names := []string{} // statuses of services registered by config are kept without services
+	for name := range state.Statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, status := range state.Statuses[name] {
+			records = append(records, &storageRecord{Type: recordStatus, Time: now, Name: name, Status: status})
+		}
+	}
+	for _, event := range state.Events {
+		records = append(records, &storageRecord{Type: recordEvent, Time: now, Name: event.Service, Event: event})
+	}
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			file.Close()
+			return fmt.Errorf("Storage: %s", err.Error())
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("Storage: %s", err.Error())
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("Storage: %s", err.Error())
+	}
+	f.file.Close()
+	if err := os.Rename(tmp, f.path); err != nil {
+		return fmt.Errorf("Storage: %s", err.Error())
+	}
+	f.file, err = os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Storage: %s", err.Error())
+	}
+	return nil
+}
+
+func remove(names []string, name string) []string {
+	result := []string{}
+	for _, n := range names {
+		if n != name {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// SetStorage restores nodes, services, statuses and history from storage
+// and persists all further changes into it, must be called before Start.
+// Nodes and services which are already registered, e.g. by LoadConfig, are kept as they are,
+// only statuses and history are restored for them
+func (o *Orchestrator) SetStorage(storage Storage) error {
+	state, err := storage.Load()
+	if err != nil {
+		return err
+	}
+	restored := 0
+	for _, node := range state.Nodes {
+		if _, err := o.GetNode(node.NodeName); err == nil {
+			continue
+		}
+		node.NodeStatus = NodeStateInitialized
+		if err := o.RegistrateNodes(node); err != nil {
+			return err
+		}
+		restored++
+	}
+	services := []*Service{}
+	for _, service := range state.Services {
+		if _, err := o.GetService(service.ServiceName); err != nil {
+			services = append(services, service)
+		}
+	}
+	if err := o.RegistrateServices(services...); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	for name, statuses := range state.Statuses {
+		registered, exist := o.service[name]
+		if !exist {
+			continue
+		}
+		for _, status := range statuses {
+			o.recordHistory(name, &registered.ServiceStatus, status)
+			registered.ServiceStatus = *status
+		}
+	}
+	for _, record := range state.Events {
+		o.recent = append(o.recent, record.event())
+		if record.ID > o.eventID {
+			o.eventID = record.ID
+		}
+	}
+	o.storage = storage
+	o.mu.Unlock()
+	o.logf(INFO, "%d nodes, %d services and %d events have been restored from storage, %d nodes and %d services are registered already",
+		restored, len(services), len(state.Events), len(state.Nodes)-restored, len(state.Services)-len(services))
+	return nil
+}
+
+// persist saves changes into storage if it is set
+func (o *Orchestrator) persist(save func(Storage) error) {
+	o.mu.RLock()
+	storage := o.storage
+	o.mu.RUnlock()
+	if storage == nil {
+		return
+	}
+	if err := save(storage); err != nil {
+		o.logf(ERROR, err.Error())
+	}
+}
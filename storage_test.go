@@ -0,0 +1,152 @@
+package orchestrator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempStorage(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "orchestrator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "state.jsonl"), func() { os.RemoveAll(dir) }
+}
+
+func TestFileStorageRoundTrip(t *testing.T) {
+	path, cleanup := tempStorage(t)
+	defer cleanup()
+	storage, err := NewFileStorage(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := NewNode(&NodeInfo{NodeName: "remote", OS: OSLinux})
+	service := NewService(&ServiceInfo{ServiceName: "a", TimeoutSeconds: 5}, localNode())
+	for _, err := range []error{
+		storage.SaveNode(localNode()),
+		storage.SaveNode(remote),
+		storage.DeleteNode("remote"),
+		storage.SaveService(service),
+		storage.SaveService(NewService(&ServiceInfo{ServiceName: "b"}, localNode())),
+		storage.DeleteService("b"),
+		storage.SaveStatus("a", &ServiceStatusInfo{ServiceStatus: ServiceStateInactive}),
+		storage.SaveStatus("a", &ServiceStatusInfo{ServiceStatus: ServiceStateDegraded}),
+		storage.SaveStatus("a", &ServiceStatusInfo{ServiceStatus: ServiceStateActive}), // first status is over limit
+		storage.SaveStatus("c", &ServiceStatusInfo{ServiceStatus: ServiceStateActive}), // service is registered by config
+		storage.SaveEvent(&EventRecord{ID: 7, Type: EventDrift, Service: "a"}),
+		storage.Close(),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if storage, err = NewFileStorage(path, 2); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	state, err := storage.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Nodes) != 1 || state.Nodes[0].NodeName != "local" {
+		t.Errorf("nodes are not restored: %v", state.Nodes)
+	}
+	if len(state.Services) != 1 || state.Services[0].ServiceName != "a" || state.Services[0].TimeoutSeconds != 5 {
+		t.Errorf("services are not restored: %v", state.Services)
+	}
+	statuses := state.Statuses["a"]
+	if len(statuses) != 2 || statuses[0].ServiceStatus != ServiceStateDegraded || statuses[1].ServiceStatus != ServiceStateActive {
+		t.Errorf("statuses are not restored: %v", statuses)
+	}
+	if len(state.Statuses["c"]) != 1 {
+		t.Errorf("status of service which is not stored is not restored")
+	}
+	if len(state.Events) != 1 || state.Events[0].ID != 7 {
+		t.Errorf("events are not restored: %v", state.Events)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 6 { // node, service, 3 statuses, event
+		t.Errorf("log is not compacted: %d records", lines)
+	}
+}
+
+func TestSetStorageKeepsRegistered(t *testing.T) {
+	path, cleanup := tempStorage(t)
+	defer cleanup()
+	storage, err := NewFileStorage(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Now().Add(-time.Minute)
+	for _, err := range []error{
+		storage.SaveNode(localNode()),
+		storage.SaveService(NewService(&ServiceInfo{ServiceName: "a", TimeoutSeconds: 5}, localNode())),
+		storage.SaveService(NewService(&ServiceInfo{ServiceName: "b"}, localNode())),
+		storage.SaveStatus("a", &ServiceStatusInfo{ServiceStatus: ServiceStateActive, ThisUpdate: t0}),
+		storage.SaveStatus("c", &ServiceStatusInfo{ServiceStatus: ServiceStateInactive, ThisUpdate: t0}),
+		storage.SaveEvent(&EventRecord{ID: 7, Type: EventDrift, Service: "a"}),
+		storage.Close(),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if storage, err = NewFileStorage(path, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	o := NewOrchestrator() // registered like by LoadConfig
+	if err := o.RegistrateNodes(localNode()); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.RegistrateServices(
+		NewService(&ServiceInfo{ServiceName: "a", TimeoutSeconds: 10}, localNode()),
+		NewService(&ServiceInfo{ServiceName: "c"}, localNode()),
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.SetStorage(storage); err != nil {
+		t.Fatal(err)
+	}
+	defer o.Stop()
+	a, err := o.GetService("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.TimeoutSeconds != 10 {
+		t.Errorf("registered service is replaced by stored one")
+	}
+	if a.ServiceStatus.ServiceStatus != ServiceStateActive {
+		t.Errorf("status of registered service is not restored: %s", a.ServiceStatus.ServiceStatus)
+	}
+	if history, err := o.History("a", time.Time{}, time.Time{}); err != nil || len(history.Transitions) != 1 {
+		t.Errorf("history of registered service is not restored: %v", err)
+	}
+	if c, err := o.GetService("c"); err != nil || c.ServiceStatus.ServiceStatus != ServiceStateInactive {
+		t.Errorf("status of service which is registered only is not restored: %v", err)
+	}
+	if _, err := o.GetService("b"); err != nil {
+		t.Errorf("stored service is not restored: %s", err.Error())
+	}
+	if o.LastEventID() != 7 {
+		t.Errorf("last event ID is %d, expected 7", o.LastEventID())
+	}
+}
+
+func TestConfigStorage(t *testing.T) {
+	config, err := ReadConfig([]byte("storage: /var/lib/orchestrator/state.jsonl\n"), ConfigYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Storage != "/var/lib/orchestrator/state.jsonl" {
+		t.Errorf("storage is '%s', expected '/var/lib/orchestrator/state.jsonl'", config.Storage)
+	}
+}
@@ -0,0 +1,253 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+)
+
+// SignatureHeader contains HMAC-SHA256 signature of webhook's body
+const SignatureHeader = "X-Orchestrator-Signature"
+
+// DefaultWebhookTimeoutSeconds is a request timeout of webhook if it is not set
+const DefaultWebhookTimeoutSeconds = 10
+
+// Webhook is an outgoing HTTP notification fired on events matched by Filter
+type Webhook struct {
+	Name           string
+	URL            string
+	Method         string // POST by default
+	Headers        map[string]string
+	Secret         string      // HMAC-SHA256 signing key, body is not signed if empty
+	BodyTemplate   string      // text/template executed with EventRecord, JSON of EventRecord by default
+	Filter         EventFilter // NotableEventTypes if Filter.Types are empty
+	MaxRetries     int
+	BackoffSeconds int // initial delay between retries, doubled on each retry
+	TimeoutSeconds int // request timeout, DefaultWebhookTimeoutSeconds if 0
+}
+
+// DeadLetter is an event which has not been delivered by webhook
+type DeadLetter struct {
+	Webhook  string
+	Event    *EventRecord
+	Attempts int
+	Error    string
+	Time     time.Time
+}
+
+type webhookRoutine struct {
+	webhook  *Webhook
+	template *template.Template
+	cancel   func()
+}
+
+func (w *Webhook) Valid() error {
+	if w.Name == "" {
+		return errors.New("Webhook validation: undefined name")
+	}
+	if w.Method == "" {
+		w.Method = http.MethodPost
+	}
+	if _, ok := HttpMethodMap[w.Method]; !ok {
+		return errors.New("Webhook validation: unknown method")
+	}
+	if _, err := url.ParseRequestURI(w.URL); err != nil {
+		return errors.New("Webhook validation: can't parse url")
+	}
+	if w.MaxRetries < 0 || w.BackoffSeconds < 0 || w.TimeoutSeconds < 0 {
+		return errors.New("Webhook validation: retries, backoff and timeout must not be negative")
+	}
+	if w.TimeoutSeconds == 0 {
+		w.TimeoutSeconds = DefaultWebhookTimeoutSeconds
+	}
+	if len(w.Filter.Types) == 0 { // status-checked events are fired on every status check
+		w.Filter.Types = append([]string{}, NotableEventTypes...)
+	}
+	if w.BodyTemplate != "" {
+		if _, err := template.New(w.Name).Parse(w.BodyTemplate); err != nil {
+			return fmt.Errorf("Webhook validation: can't parse body template: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+func (w *Webhook) copy() *Webhook {
+	cp := *w
+	if w.Headers != nil {
+		cp.Headers = make(map[string]string, len(w.Headers))
+		for key, value := range w.Headers {
+			cp.Headers[key] = value
+		}
+	}
+	cp.Filter = w.Filter.copy()
+	return &cp
+}
+
+// Sign returns hex encoded HMAC-SHA256 of body
+func (w *Webhook) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) body(tmpl *template.Template, record *EventRecord) ([]byte, error) {
+	if tmpl == nil {
+		return json.Marshal(record)
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, record); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *Webhook) maskSecret() {
+	if w.Secret != "" {
+		w.Secret = "***"
+	}
+}
+
+// Send delivers body once
+func (w *Webhook) Send(body []byte) error {
+	return w.send(context.Background(), body)
+}
+
+// send delivers body once, request is canceled when ctx is done
+func (w *Webhook) send(ctx context.Context, body []byte) error {
+	request, err := http.NewRequest(w.Method, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Webhook: %s", err.Error())
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range w.Headers {
+		request.Header.Set(key, value)
+	}
+	if w.Secret != "" {
+		request.Header.Set(SignatureHeader, w.Sign(body))
+	}
+	timeout := w.TimeoutSeconds
+	if timeout == 0 {
+		timeout = DefaultWebhookTimeoutSeconds
+	}
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	resp, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("Webhook: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook: unexpected status '%d'", resp.StatusCode)
+	}
+	return nil
+}
+
+// AddWebhooks validates webhooks and starts their delivery routines
+func (o *Orchestrator) AddWebhooks(webhooks ...*Webhook) error {
+	for _, webhook := range webhooks {
+		if err := webhook.Valid(); err != nil {
+			return err
+		}
+		var tmpl *template.Template
+		if webhook.BodyTemplate != "" {
+			tmpl = template.Must(template.New(webhook.Name).Parse(webhook.BodyTemplate))
+		}
+		o.mu.Lock()
+		if _, exist := o.webhook[webhook.Name]; exist {
+			o.mu.Unlock()
+			return o.Errorf("'%s' webhook already exist", webhook.Name)
+		}
+		cp := webhook.copy()
+		routine := &webhookRoutine{cp, tmpl, nil}
+		o.webhook[webhook.Name] = routine
+		o.mu.Unlock()
+		events, cancel := o.Subscribe(&cp.Filter)
+		routine.cancel = cancel
+		o.spawn(func() { o.webhookRoutine(routine, events) })
+		o.logf(INFO, "'%s' webhook has been added", webhook.Name)
+	}
+	return nil
+}
+
+func (o *Orchestrator) RemoveWebhook(name string) error {
+	o.mu.Lock()
+	routine, exist := o.webhook[name]
+	if !exist {
+		o.mu.Unlock()
+		return o.Errorf("'%s' webhook is not exist", name)
+	}
+	delete(o.webhook, name)
+	o.mu.Unlock()
+	routine.cancel()
+	o.logf(INFO, "'%s' webhook has been deleted", name)
+	return nil
+}
+
+func (o *Orchestrator) Webhooks() []*Webhook {
+	o.mu.RLock()
+	webhooks := []*Webhook{}
+	for _, routine := range o.webhook {
+		webhooks = append(webhooks, routine.webhook.copy())
+	}
+	o.mu.RUnlock()
+	return webhooks
+}
+
+func (o *Orchestrator) DeadLetters() []*DeadLetter {
+	o.mu.RLock()
+	letters := make([]*DeadLetter, len(o.deadLetter))
+	for i, letter := range o.deadLetter {
+		cp := *letter
+		e := letter.Event.event()
+		e = e.copy()
+		cp.Event = e.record()
+		letters[i] = &cp
+	}
+	o.mu.RUnlock()
+	return letters
+}
+
+func (o *Orchestrator) webhookRoutine(routine *webhookRoutine, events <-chan Event) {
+	for e := range events {
+		record := e.record()
+		body, err := routine.webhook.body(routine.template, record)
+		attempts := 0
+		if err == nil {
+			delay := time.Duration(routine.webhook.BackoffSeconds) * time.Second
+		retry:
+			for {
+				attempts++
+				if err = routine.webhook.send(o.ctx, body); err == nil || attempts > routine.webhook.MaxRetries {
+					break
+				}
+				o.logf(DEBUG, "'%s' webhook attempt #%d error: %s", routine.webhook.Name, attempts, err.Error())
+				select {
+				case <-o.ctx.Done(): // event is dead-lettered on shutdown
+					break retry
+				case <-time.After(delay):
+				}
+				delay *= 2
+			}
+		}
+		if err != nil {
+			o.logf(ERROR, "'%s' webhook has not delivered event #%d: %s", routine.webhook.Name, e.ID, err.Error())
+			o.mu.Lock()
+			o.deadLetter = append(o.deadLetter, &DeadLetter{routine.webhook.Name, record, attempts, err.Error(), time.Now()})
+			if len(o.deadLetter) > o.hLimit {
+				o.deadLetter = append([]*DeadLetter{}, o.deadLetter[len(o.deadLetter)-o.hLimit:]...)
+			}
+			o.mu.Unlock()
+			continue
+		}
+		o.logf(DEBUG, "'%s' webhook has delivered event #%d", routine.webhook.Name, e.ID)
+	}
+}
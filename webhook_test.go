@@ -0,0 +1,135 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookServer responds with status codes in order, then with 200 OK
+func webhookServer(codes ...int) (*httptest.Server, <-chan delivery, *int32) {
+	deliveries := make(chan delivery, 10)
+	requests := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(requests, 1))
+		if n <= len(codes) {
+			w.WriteHeader(codes[n-1])
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		deliveries <- delivery{r.Header, body}
+	}))
+	return server, deliveries, requests
+}
+
+func waitDelivery(t *testing.T, deliveries <-chan delivery) delivery {
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook has not delivered event")
+	}
+	return delivery{}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	server, deliveries, _ := webhookServer()
+	defer server.Close()
+	o := NewOrchestrator()
+	defer o.Stop()
+	webhook := &Webhook{Name: "hook", URL: server.URL, Secret: "secret", Headers: map[string]string{"X-Test": "yes"}}
+	if err := o.AddWebhooks(webhook); err != nil {
+		t.Fatal(err)
+	}
+	if webhook.TimeoutSeconds != DefaultWebhookTimeoutSeconds {
+		t.Errorf("webhook has %d timeout, expected %d", webhook.TimeoutSeconds, DefaultWebhookTimeoutSeconds)
+	}
+
+	o.publish(Event{Type: EventStatusChecked, Service: "a"}) // not notable, filtered out by default
+	o.publish(Event{Type: EventStatusChanged, Service: "a", From: ServiceStateActive, To: ServiceStateInactive})
+	d := waitDelivery(t, deliveries)
+	record := new(EventRecord)
+	if err := json.Unmarshal(d.body, record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Type != EventStatusChanged || record.Service != "a" || record.To == nil || *record.To != ServiceStateInactive {
+		t.Errorf("unexpected event is delivered: %s", d.body)
+	}
+	if signature := d.header.Get(SignatureHeader); signature != webhook.Sign(d.body) {
+		t.Errorf("body is signed by '%s', expected '%s'", signature, webhook.Sign(d.body))
+	}
+	if d.header.Get("X-Test") != "yes" {
+		t.Error("header of webhook is not sent")
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	server, deliveries, _ := webhookServer()
+	defer server.Close()
+	o := NewOrchestrator()
+	defer o.Stop()
+	webhook := &Webhook{Name: "hook", URL: server.URL, BodyTemplate: `{{.Service}} is {{.To}}`}
+	if err := o.AddWebhooks(webhook); err != nil {
+		t.Fatal(err)
+	}
+	o.publish(Event{Type: EventStatusChanged, Service: "a", From: ServiceStateActive, To: ServiceStateInactive})
+	d := waitDelivery(t, deliveries)
+	if expected := "a is " + ServiceStateInactive.String(); string(d.body) != expected {
+		t.Errorf("body is '%s', expected '%s'", d.body, expected)
+	}
+	if d.header.Get(SignatureHeader) != "" {
+		t.Error("body is signed without secret")
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	server, deliveries, requests := webhookServer(http.StatusInternalServerError, http.StatusBadGateway)
+	defer server.Close()
+	o := NewOrchestrator()
+	defer o.Stop()
+	if err := o.AddWebhooks(&Webhook{Name: "hook", URL: server.URL, MaxRetries: 2}); err != nil {
+		t.Fatal(err)
+	}
+	o.publish(Event{Type: EventServiceStarted, Service: "a", Node: "local"})
+	waitDelivery(t, deliveries)
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Errorf("event is delivered by %d requests, expected 3", n)
+	}
+	if letters := o.DeadLetters(); len(letters) != 0 {
+		t.Errorf("%d dead letters of delivered event", len(letters))
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	server, _, requests := webhookServer(http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	defer server.Close()
+	o := NewOrchestrator()
+	defer o.Stop()
+	if err := o.AddWebhooks(&Webhook{Name: "hook", URL: server.URL, MaxRetries: 1}); err != nil {
+		t.Fatal(err)
+	}
+	o.publish(Event{Type: EventServiceStopped, Service: "a", Node: "local"})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(o.DeadLetters()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	letters := o.DeadLetters()
+	if len(letters) != 1 {
+		t.Fatalf("%d dead letters, expected 1", len(letters))
+	}
+	if letters[0].Webhook != "hook" || letters[0].Attempts != 2 || letters[0].Event.Type != EventServiceStopped {
+		t.Errorf("unexpected dead letter: %+v", letters[0])
+	}
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("%d requests, expected 2", n)
+	}
+}